@@ -0,0 +1,187 @@
+// Package analyzer 提供检查@autodig注释和autodig field tag的go/analysis Analyzer,
+// 可以在gopls和go vet中使用, 解析规则与生成代码时一致
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"github.com/cindyoshinee/autodig/dep"
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "autodig",
+	Doc:  "check @autodig annotations and autodig struct tags",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				checkFuncDecl(pass, decl)
+			case *ast.GenDecl:
+				checkGenDecl(pass, decl)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func checkFuncDecl(pass *analysis.Pass, decl *ast.FuncDecl) {
+	comment, annotation := dep.FindAnnotation(decl.Doc)
+	if annotation == nil {
+		return
+	}
+	reportProblems(pass, comment, annotation.Problems)
+	if decl.Recv != nil {
+		pass.Reportf(comment.Pos(), "@autodig is not supported on method %s", decl.Name.Name)
+		return
+	}
+	if decl.Type.Results == nil || len(decl.Type.Results.List) == 0 {
+		pass.Reportf(comment.Pos(), "@autodig func %s must return at least one value", decl.Name.Name)
+	}
+}
+
+func checkGenDecl(pass *analysis.Pass, decl *ast.GenDecl) {
+	comment, annotation := dep.FindAnnotation(decl.Doc)
+	if annotation != nil {
+		reportProblems(pass, comment, annotation.Problems)
+		checkAnnotatedGenDecl(pass, decl, comment)
+	}
+	for i, spec := range decl.Specs {
+		typeSpec, ok := spec.(*ast.TypeSpec)
+		if !ok {
+			continue
+		}
+		if specComment, _ := dep.FindAnnotation(typeSpec.Doc); specComment != nil && decl.Lparen.IsValid() {
+			pass.Reportf(specComment.Pos(), "@autodig inside a grouped type declaration is ignored, declare %s separately", typeSpec.Name.Name)
+		}
+		structType, ok := typeSpec.Type.(*ast.StructType)
+		if !ok {
+			continue
+		}
+		checkFields(pass, structType, annotation != nil && i == 0)
+	}
+}
+
+func checkAnnotatedGenDecl(pass *analysis.Pass, decl *ast.GenDecl, comment *ast.Comment) {
+	if decl.Tok != token.TYPE {
+		pass.Reportf(comment.Pos(), "@autodig is only supported on struct types and funcs, not on %s declarations", decl.Tok)
+		return
+	}
+	if len(decl.Specs) == 0 {
+		pass.Reportf(comment.Pos(), "@autodig on an empty type declaration is ignored")
+		return
+	}
+	if len(decl.Specs) > 1 {
+		pass.Reportf(comment.Pos(), "@autodig on a grouped type declaration only applies to its first type")
+	}
+	typeSpec := decl.Specs[0].(*ast.TypeSpec)
+	if _, ok := typeSpec.Type.(*ast.StructType); !ok {
+		pass.Reportf(comment.Pos(), "@autodig is only supported on struct types, %s is %s", typeSpec.Name.Name, describeType(typeSpec.Type))
+	}
+}
+
+func checkFields(pass *analysis.Pass, structType *ast.StructType, annotated bool) {
+	for _, field := range structType.Fields.List {
+		info := dep.ParseFieldAnnotation(field)
+		if field.Tag != nil {
+			reportTagProblems(pass, field.Tag, info.Problems)
+		}
+		if info.IsReturn {
+			checkReturnField(pass, field, info, annotated)
+			continue
+		}
+		if !annotated || info.Ignore {
+			continue
+		}
+		if info.InGroup != "" {
+			checkInGroupField(pass, field, info)
+		}
+		if len(field.Names) > 0 && !field.Names[0].IsExported() && (info.InGroup != "" || info.Name != "") {
+			pass.Reportf(field.Pos(), "autodig tag on unexported field %s is ignored", field.Names[0].Name)
+		}
+	}
+}
+
+func checkReturnField(pass *analysis.Pass, field *ast.Field, info *dep.FieldAnnotation, annotated bool) {
+	if !annotated {
+		pass.Reportf(field.Pos(), "%s only has effect in a struct annotated with @autodig", dep.ReturnFieldName)
+		return
+	}
+	if info.InGroup != "" || info.Name != "" {
+		pass.Reportf(field.Tag.Pos(), "autodig tag on %s is ignored, use the @autodig comment of the struct instead", dep.ReturnFieldName)
+	}
+	if typ := pass.TypesInfo.TypeOf(field.Type); typ != nil && !types.IsInterface(typ) {
+		pass.Reportf(field.Type.Pos(), "%s should be an interface type, got %s", dep.ReturnFieldName, typ)
+	}
+}
+
+func checkInGroupField(pass *analysis.Pass, field *ast.Field, info *dep.FieldAnnotation) {
+	if dep.IsInGroupType(field.Type) {
+		return
+	}
+	typeText := types.ExprString(field.Type)
+	diagnostic := analysis.Diagnostic{
+		Pos:     field.Type.Pos(),
+		End:     field.Type.End(),
+		Message: fmt.Sprintf("field with ingroup:%s should be a slice, got %s", info.InGroup, typeText),
+	}
+	// 数组改成[][N]T并不是想要的结果, 只对非数组类型给出修复
+	if _, ok := field.Type.(*ast.ArrayType); !ok {
+		diagnostic.SuggestedFixes = []analysis.SuggestedFix{{
+			Message:   fmt.Sprintf("change type to []%s", typeText),
+			TextEdits: []analysis.TextEdit{{Pos: field.Type.Pos(), End: field.Type.End(), NewText: []byte("[]" + typeText)}},
+		}}
+	}
+	pass.Report(diagnostic)
+}
+
+func reportProblems(pass *analysis.Pass, comment *ast.Comment, problems []dep.AnnotationProblem) {
+	for _, problem := range problems {
+		pos := comment.Pos()
+		if problem.Offset >= 0 {
+			pos += token.Pos(problem.Offset)
+		}
+		report(pass, pos, problem)
+	}
+}
+
+func reportTagProblems(pass *analysis.Pass, tag *ast.BasicLit, problems []dep.AnnotationProblem) {
+	for _, problem := range problems {
+		pos := tag.Pos()
+		if problem.Offset >= 0 {
+			pos += token.Pos(problem.Offset)
+		}
+		report(pass, pos, problem)
+	}
+}
+
+func report(pass *analysis.Pass, pos token.Pos, problem dep.AnnotationProblem) {
+	diagnostic := analysis.Diagnostic{Pos: pos, Message: problem.Msg}
+	if problem.Suggestion != "" && problem.Offset >= 0 {
+		end := pos + token.Pos(len(problem.Key))
+		diagnostic.End = end
+		diagnostic.SuggestedFixes = []analysis.SuggestedFix{{
+			Message:   fmt.Sprintf("replace %q with %q", problem.Key, problem.Suggestion),
+			TextEdits: []analysis.TextEdit{{Pos: pos, End: end, NewText: []byte(problem.Suggestion)}},
+		}}
+	}
+	pass.Report(diagnostic)
+}
+
+func describeType(expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.InterfaceType:
+		return "an interface"
+	case *ast.FuncType:
+		return "a func type"
+	default:
+		return "not a struct"
+	}
+}
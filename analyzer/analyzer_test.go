@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// TestAnalyzer testdata与analysistest.RunWithSuggestedFixes的格式相同: 每条diagnostic对应同一行的// want, 修复后的结果为.golden.
+// x/tools v0.1.5的go/packages在Go 1.22之后加载类型时会panic(types.SizesFor不再返回*types.StdSizes), 这里直接用go/types类型检查
+func TestAnalyzer(t *testing.T) {
+	dir := filepath.Join("testdata", "src", "a")
+	fset := token.NewFileSet()
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make([]*ast.File, 0, len(names))
+	for _, name := range names {
+		file, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	pkg, err := (&types.Config{Importer: importer.Default()}).Check("a", fset, files, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diagnostics := make([]analysis.Diagnostic, 0)
+	pass := &analysis.Pass{
+		Analyzer:   Analyzer,
+		Fset:       fset,
+		Files:      files,
+		Pkg:        pkg,
+		TypesInfo:  info,
+		TypesSizes: types.SizesFor("gc", runtime.GOARCH),
+		Report:     func(d analysis.Diagnostic) { diagnostics = append(diagnostics, d) },
+	}
+	if _, err := Analyzer.Run(pass); err != nil {
+		t.Fatal(err)
+	}
+
+	wants := parseWants(t, fset, files)
+	edits := make(map[string][]analysis.TextEdit)
+	for _, d := range diagnostics {
+		posn := fset.Position(d.Pos)
+		key := fmt.Sprintf("%s:%d", posn.Filename, posn.Line)
+		matched := false
+		for i, re := range wants[key] {
+			if re.MatchString(d.Message) {
+				wants[key] = append(wants[key][:i], wants[key][i+1:]...)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			t.Errorf("%s: unexpected diagnostic: %s", posn, d.Message)
+		}
+		for _, fix := range d.SuggestedFixes {
+			for _, edit := range fix.TextEdits {
+				edits[posn.Filename] = append(edits[posn.Filename], edit)
+			}
+		}
+	}
+	for key, res := range wants {
+		for _, re := range res {
+			t.Errorf("%s: no diagnostic was reported matching %q", key, re)
+		}
+	}
+
+	for i, name := range names {
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden, err := ioutil.ReadFile(name + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := format.Source(applyEdits(fset.File(files[i].Pos()), content, edits[name]))
+		if err != nil {
+			t.Fatalf("format %s after fixes err: %v", name, err)
+		}
+		if !bytes.Equal(got, golden) {
+			t.Errorf("%s after suggested fixes =\n%s\nwant\n%s", name, got, golden)
+		}
+	}
+}
+
+var wantReg = regexp.MustCompile(`// want (.*)$`)
+
+// parseWants 返回每一行期望的diagnostic, key为file:line
+func parseWants(t *testing.T, fset *token.FileSet, files []*ast.File) map[string][]*regexp.Regexp {
+	wants := make(map[string][]*regexp.Regexp)
+	for _, file := range files {
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				match := wantReg.FindStringSubmatch(comment.Text)
+				if match == nil {
+					continue
+				}
+				posn := fset.Position(comment.Pos())
+				key := fmt.Sprintf("%s:%d", posn.Filename, posn.Line)
+				for rest := strings.TrimSpace(match[1]); rest != ""; {
+					quoted, err := strconv.QuotedPrefix(rest)
+					if err != nil {
+						t.Fatalf("%s: bad want %q: %v", posn, rest, err)
+					}
+					pattern, _ := strconv.Unquote(quoted)
+					wants[key] = append(wants[key], regexp.MustCompile(pattern))
+					rest = strings.TrimSpace(rest[len(quoted):])
+				}
+			}
+		}
+	}
+	return wants
+}
+
+// applyEdits 从后往前替换, edit之间不能重叠
+func applyEdits(file *token.File, content []byte, edits []analysis.TextEdit) []byte {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].Pos > edits[j].Pos })
+	ret := append([]byte{}, content...)
+	for _, edit := range edits {
+		start, end := file.Offset(edit.Pos), file.Offset(edit.End)
+		ret = append(ret[:start:start], append(append([]byte{}, edit.NewText...), ret[end:]...)...)
+	}
+	return ret
+}
@@ -0,0 +1,11 @@
+// autodigvet checks @autodig annotations, can also be used with `go vet -vettool=$(which autodigvet)`
+package main
+
+import (
+	"github.com/cindyoshinee/autodig/analyzer"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(analyzer.Analyzer)
+}
@@ -0,0 +1,71 @@
+// @autodig注释写成/* */, 同一行的// want不会被当作注释中的key
+package a
+
+import "io"
+
+type Client struct{}
+
+/* @autodig outgrop:x */ // want `unknown key "outgrop", did you mean "outgroup"\?`
+func NewClient() *Client { return &Client{} }
+
+/* @autodig name: */    // want `"name" requires a value, e.g. name:xxx`
+func NewNamed() *Client { return &Client{} }
+
+/* @autodig foo:bar */ // want `unknown key "foo"$`
+func NewFoo() *Client  { return &Client{} }
+
+/* @autodig */  // want `@autodig func NoResult must return at least one value`
+func NoResult() {}
+
+/* @autodig */           // want `@autodig is not supported on method Close`
+func (c *Client) Close() {}
+
+/* @autodig */ // want `@autodig is only supported on struct types and funcs, not on var declarations`
+var x = 1
+
+/* @autodig */ // want `@autodig is only supported on struct types and funcs, not on var declarations`
+var ()
+
+/* @autodig */ // want `@autodig on an empty type declaration is ignored`
+type ()
+
+/* @autodig */ // want `@autodig on a grouped type declaration only applies to its first type`
+type (
+	First  struct{}
+	Second struct{}
+)
+
+type (
+	/* @autodig */ // want `@autodig inside a grouped type declaration is ignored, declare Inner separately`
+	Inner          struct{}
+	Other          struct{}
+)
+
+/* @autodig */ // want `@autodig is only supported on struct types, Reader is an interface`
+type Reader interface{ Read() }
+
+/* @autodig */ // want `@autodig is only supported on struct types, Handler is a func type`
+type Handler func()
+
+/* @autodig */ // want `@autodig is only supported on struct types, ID is not a struct`
+type ID int
+
+/* @autodig */
+type Service struct {
+	Client    *Client    `autodig:"nam:x"` // want `unknown key "nam", did you mean "name"\?`
+	Clients   []*Client  `autodig:"ingroup:c"`
+	One       *Client    `autodig:"ingroup:c"`  // want `field with ingroup:c should be a slice, got \*Client`
+	Fixed     [2]*Client `autodig:"ingroup:c"`  // want `field with ingroup:c should be a slice, got \[2\]\*Client`
+	hidden    *Client    `autodig:"name:x"`     // want `autodig tag on unexported field hidden is ignored`
+	DigReturn io.Reader  `autodig:"name:x"`     // want `autodig tag on DigReturn is ignored, use the @autodig comment of the struct instead`
+	Skipped   *Client    `autodig:"-,ingrop:c"` // want `unknown key "ingrop", did you mean "ingroup"\?`
+}
+
+/* @autodig */
+type NotIface struct {
+	DigReturn *Client // want `DigReturn should be an interface type, got \*a.Client`
+}
+
+type Plain struct {
+	DigReturn io.Reader // want `DigReturn only has effect in a struct annotated with @autodig`
+}
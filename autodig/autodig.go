@@ -0,0 +1,221 @@
+// Package autodig 以库的方式使用autodig: 通过Option配置, 在内存中生成代码,
+// 不写入文件也不输出到stdout, 可以嵌入到构建工具和测试中
+package autodig
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/cindyoshinee/autodig/dep"
+)
+
+type Option func(*options)
+
+type options struct {
+	config dep.Config
+	writer io.Writer
+}
+
+// WithConfig 使用配置文件的内容(如dep.LoadConfig的结果)作为基础, 之后的Option会覆盖其中的值
+func WithConfig(config *dep.Config) Option {
+	return func(o *options) {
+		o.config = *config
+	}
+}
+
+// WithScans 扫描的目录
+func WithScans(dirs ...string) Option {
+	return func(o *options) {
+		o.config.Scans = dirs
+	}
+}
+
+// WithOutput 输出文件, 也可以是目录, 此时输出到目录下的autodig.go
+func WithOutput(file string) Option {
+	return func(o *options) {
+		o.config.Output = file
+	}
+}
+
+// WithTag 只生成没有tag或tag相同的声明, 同命令行的-tag
+func WithTag(tag string) Option {
+	return func(o *options) {
+		o.config.Tag = tag
+	}
+}
+
+// WithTags 判断//go:build时使用的build tags, 同命令行的-tags
+func WithTags(tags ...string) Option {
+	return func(o *options) {
+		o.config.BuildTags = tags
+	}
+}
+
+func WithGOOS(goos string) Option {
+	return func(o *options) {
+		o.config.GOOS = goos
+	}
+}
+
+func WithGOARCH(goarch string) Option {
+	return func(o *options) {
+		o.config.GOARCH = goarch
+	}
+}
+
+// WithExcludes 跳过的文件和目录, 规则同命令行的-exclude
+func WithExcludes(patterns ...string) Option {
+	return func(o *options) {
+		o.config.Excludes = patterns
+	}
+}
+
+// WithIncludes 需要扫描的生成文件
+func WithIncludes(patterns ...string) Option {
+	return func(o *options) {
+		o.config.Includes = patterns
+	}
+}
+
+func WithStrict(strict bool) Option {
+	return func(o *options) {
+		o.config.Strict = &strict
+	}
+}
+
+// WithMaxErrors 达到n个错误后停止, <= 0表示不限制
+func WithMaxErrors(n int) Option {
+	return func(o *options) {
+		o.config.MaxErrors = n
+	}
+}
+
+// WithMode dep.OutputModeSingle或dep.OutputModePackage
+func WithMode(mode string) Option {
+	return func(o *options) {
+		o.config.Mode = mode
+	}
+}
+
+func WithRuntimePackage(path string) Option {
+	return func(o *options) {
+		o.config.RuntimePackage = path
+	}
+}
+
+func WithNaming(naming dep.Naming) Option {
+	return func(o *options) {
+		o.config.Naming = naming
+	}
+}
+
+func WithFakes(fakes bool) Option {
+	return func(o *options) {
+		o.config.Fakes = fakes
+	}
+}
+
+func WithLineDirectives(lineDirectives bool) Option {
+	return func(o *options) {
+		o.config.LineDirectives = lineDirectives
+	}
+}
+
+// WithCacheDir 加载包的缓存目录, 默认不使用磁盘缓存
+func WithCacheDir(dir string) Option {
+	return func(o *options) {
+		o.config.CacheDir = dir
+	}
+}
+
+// WithWriter 生成成功后把输出文件的内容写入w
+func WithWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.writer = w
+	}
+}
+
+type Generator struct {
+	opts options
+}
+
+// New 没有WithScans/WithOutput时扫描./app, 输出到./app/entrypoint/autodig.go, 与命令行的默认值一致
+func New(opts ...Option) *Generator {
+	g := &Generator{}
+	for _, opt := range opts {
+		opt(&g.opts)
+	}
+	if len(g.opts.config.Scans) == 0 {
+		g.opts.config.Scans = []string{"./app"}
+	}
+	if g.opts.config.Output == "" {
+		g.opts.config.Output = "./app/entrypoint/autodig.go"
+	}
+	return g
+}
+
+// File 一个生成的文件
+type File struct {
+	Path   string
+	Source []byte
+}
+
+type Result struct {
+	// Output 输出文件的绝对路径
+	Output string
+	// Source 输出文件的内容, package模式下是调用各个包Register的文件, 各个包的autodig_gen.go只在Files中
+	Source []byte
+	// Files 所有生成的文件, 包括Output以及package模式的autodig_gen.go、autodig_fake.go和autodig_test.go, 按路径排序
+	Files []*File
+	// Stale 之前生成但现在应该删除的文件
+	Stale []string
+	// Providers 扫描到的所有provider
+	Providers []*dep.Provider
+	// Graph provider之间的依赖关系分析
+	Graph *dep.GraphReport
+	// Diagnostics 所有错误和警告, 按位置排序
+	Diagnostics []*dep.Diagnostic
+}
+
+// Generate 在内存中生成代码, 只读取扫描目录中的源码, 不会写入任何文件.
+// 出错时也会返回Result, 其中的Diagnostics和Providers可以用来定位问题
+func (g *Generator) Generate(ctx context.Context) (*Result, error) {
+	config := g.opts.config
+	config.Scans = append([]string{}, config.Scans...)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	autodig := config.NewAutodig()
+	files, stale, err := autodig.Generate(ctx)
+	result := &Result{
+		Stale:       stale,
+		Providers:   autodig.Providers(),
+		Graph:       autodig.Report(),
+		Diagnostics: autodig.Diagnostics().List(),
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err != nil {
+		return result, err
+	}
+	for _, file := range files {
+		result.Files = append(result.Files, &File{Path: file.Path, Source: file.Content})
+	}
+	sort.Slice(result.Files, func(i, j int) bool {
+		return result.Files[i].Path < result.Files[j].Path
+	})
+	result.Output = autodig.OutputFile()
+	for _, file := range result.Files {
+		if file.Path == result.Output {
+			result.Source = file.Source
+		}
+	}
+	if g.opts.writer != nil {
+		if _, err := g.opts.writer.Write(result.Source); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,171 @@
+package autodig
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cindyoshinee/autodig/dep"
+)
+
+// newTestModule 在临时目录中创建module example.com/x并写入files, 通过replace使用当前的autodig, 返回module根目录
+func newTestModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile(filepath.Join(repo, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["go.mod"] = fmt.Sprintf("module example.com/x\n\ngo 1.13\n\nrequire github.com/cindyoshinee/autodig v0.0.0\n\nreplace github.com/cindyoshinee/autodig => %s\n", repo)
+	files["go.sum"] = string(sum)
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 缺少的require从autodig的go.mod补全, 不访问网络
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	return root
+}
+
+// listFiles root下所有文件的相对路径
+func listFiles(t *testing.T, root string) []string {
+	t.Helper()
+	files := make([]string, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(root, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+const serviceSource = `package a
+
+type Client struct{}
+
+// @autodig
+func NewClient() *Client {
+	return &Client{}
+}
+
+// @autodig
+type Service struct {
+	Client *Client
+}
+`
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		mode string
+		// wantFiles Result.Files中相对module根目录的路径
+		wantFiles []string
+		// wantSource Result.Source中应包含的内容
+		wantSource string
+	}{
+		{mode: dep.OutputModeSingle, wantFiles: []string{"app/entrypoint/autodig.go"}, wantSource: "dep.MustProvide("},
+		{mode: dep.OutputModePackage, wantFiles: []string{"app/a/autodig_gen.go", "app/entrypoint/autodig.go"}, wantSource: "dep.MustRegister(a.Register)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			root := newTestModule(t, map[string]string{
+				"app/a/a.go":             serviceSource,
+				"app/entrypoint/main.go": "package entrypoint\n",
+			})
+			before := listFiles(t, root)
+			writer := &bytes.Buffer{}
+			result, err := New(
+				WithScans(filepath.Join(root, "app")),
+				WithOutput(filepath.Join(root, "app", "entrypoint")),
+				WithMode(tt.mode),
+				WithWriter(writer),
+			).Generate(context.Background())
+			if err != nil {
+				t.Fatalf("Generate() err: %v", err)
+			}
+			if want := filepath.Join(root, "app", "entrypoint", "autodig.go"); result.Output != want {
+				t.Errorf("Output = %s, want %s", result.Output, want)
+			}
+			gotFiles := make([]string, 0)
+			for _, file := range result.Files {
+				rel, _ := filepath.Rel(root, file.Path)
+				gotFiles = append(gotFiles, filepath.ToSlash(rel))
+				if file.Path == result.Output && !bytes.Equal(file.Source, result.Source) {
+					t.Errorf("Source is not the content of %s", file.Path)
+				}
+			}
+			if strings.Join(gotFiles, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Errorf("Files = %v, want %v", gotFiles, tt.wantFiles)
+			}
+			if !bytes.Contains(result.Source, []byte(tt.wantSource)) {
+				t.Errorf("Source does not contain %q:\n%s", tt.wantSource, result.Source)
+			}
+			if !bytes.Equal(writer.Bytes(), result.Source) {
+				t.Errorf("WithWriter got %q, want Source", writer.Bytes())
+			}
+			symbols := make([]string, 0)
+			for _, provider := range result.Providers {
+				symbols = append(symbols, provider.Symbol)
+			}
+			if strings.Join(symbols, ",") != "a.NewClient,a.Service" {
+				t.Errorf("Providers = %v, want a.NewClient and a.Service", symbols)
+			}
+			if len(result.Diagnostics) != 0 || result.Graph == nil {
+				t.Errorf("Diagnostics = %v, Graph = %v, want no diagnostics and a graph", result.Diagnostics, result.Graph)
+			}
+			// 不写入任何文件
+			if after := listFiles(t, root); strings.Join(after, ",") != strings.Join(before, ",") {
+				t.Errorf("files after Generate() = %v, want unchanged %v", after, before)
+			}
+		})
+	}
+}
+
+func TestGenerateErrorResult(t *testing.T) {
+	root := newTestModule(t, map[string]string{
+		"app/a/a.go":             serviceSource + "\n// @autodig outgrop:x\nfunc NewOther() *Client {\n\treturn nil\n}\n",
+		"app/entrypoint/main.go": "package entrypoint\n",
+	})
+	result, err := New(
+		WithScans(filepath.Join(root, "app")),
+		WithOutput(filepath.Join(root, "app", "entrypoint", "autodig.go")),
+		WithStrict(true),
+	).Generate(context.Background())
+	if err == nil {
+		t.Fatalf("Generate() err = nil, want the strict error")
+	}
+	// 出错时仍然返回Diagnostics, 但没有生成的文件
+	if result == nil || len(result.Diagnostics) != 1 || !strings.Contains(result.Diagnostics[0].Msg, `unknown key "outgrop"`) {
+		t.Fatalf("Result = %+v, want one unknown key diagnostic", result)
+	}
+	if result.Diagnostics[0].Pos.Line != 15 || len(result.Files) != 0 || result.Source != nil {
+		t.Errorf("Diagnostic = %v, Files = %v, want a.go:15 and no files", result.Diagnostics[0], result.Files)
+	}
+}
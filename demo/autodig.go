@@ -1,4 +1,7 @@
 // Code generated by autodig. DO NOT EDIT.
+// autodig version: v0.2.0
+// autodig inputs: sha256:4a37f191b4c9f7c429cd8b79c8679136a6c36c2d25ffe7ee7d1925592523cf93
+
 package demo
 
 import (
@@ -6,15 +9,27 @@ import (
 	dig "go.uber.org/dig"
 )
 
+// source: demo/sourcecode.go:12 (@autodig outgroup:restControllers)
 func NewdemoControllerDemo(Service *Service) (ControllerI, error) {
 	var autoDigErr error
 	controllerdemo := ControllerDemo{Service: Service, DigReturn: nil}
-	autoDigErr = controllerdemo.Init()
+	autoDigErr = dep.WrapInitError(dep.Source{Symbol: "demo.ControllerDemo", Position: "demo/sourcecode.go:12", Annotation: "@autodig outgroup:restControllers"}, controllerdemo.Init())
 	return &controllerdemo, autoDigErr
 }
+
+var _ ControllerI = (*ControllerDemo)(nil)
+
+// source: demo/sourcecode.go:25 (@autodig)
 func demo_NewGrpcClient() *GrpcClient {
 	return NewGrpcClient()
 }
+
+// source: demo/sourcecode.go:30 (@autodig name:abGrpcClient)
+func demo_NewAbGrpcClient() *GrpcClient {
+	return NewAbGrpcClient()
+}
+
+// source: demo/sourcecode.go:35 (@autodig)
 func NewdemoService(GrpcClient *GrpcClient, demoServiceParam struct {
 	dig.In
 	Logger       []Logger    `group:"loggers"`
@@ -24,19 +39,18 @@ func NewdemoService(GrpcClient *GrpcClient, demoServiceParam struct {
 	service := Service{GrpcClient: GrpcClient, Logger: demoServiceParam.Logger, AbGrpcClient: demoServiceParam.AbGrpcClient}
 	return &service, autoDigErr
 }
-func demo_NewAbGrpcClient() *GrpcClient {
-	return NewAbGrpcClient()
-}
+
+// source: demo/sourcecode.go:47 (@autodig outgroup:loggers)
 func demo_NewLogger() Logger {
 	return NewLogger()
 }
 func init() {
 	dep.MustProvide([]interface {
-	}{demo_NewGrpcClient, NewdemoService})
+	}{dep.WithSource(demo_NewGrpcClient, dep.Source{Symbol: "demo.NewGrpcClient", Position: "demo/sourcecode.go:25", Annotation: "@autodig"}), dep.WithSource(NewdemoService, dep.Source{Symbol: "demo.Service", Position: "demo/sourcecode.go:35", Annotation: "@autodig"})})
 	dep.MustProvide([]interface {
-	}{demo_NewAbGrpcClient}, dig.Name("abGrpcClient"))
+	}{dep.WithSource(demo_NewAbGrpcClient, dep.Source{Symbol: "demo.NewAbGrpcClient", Position: "demo/sourcecode.go:30", Annotation: "@autodig name:abGrpcClient"})}, dig.Name("abGrpcClient"))
 	dep.MustProvide([]interface {
-	}{demo_NewLogger}, dig.Group("loggers"))
+	}{dep.WithSource(demo_NewLogger, dep.Source{Symbol: "demo.NewLogger", Position: "demo/sourcecode.go:47", Annotation: "@autodig outgroup:loggers"})}, dig.Group("loggers"))
 	dep.MustProvide([]interface {
-	}{NewdemoControllerDemo}, dig.Group("restControllers"))
+	}{dep.WithSource(NewdemoControllerDemo, dep.Source{Symbol: "demo.ControllerDemo", Position: "demo/sourcecode.go:12", Annotation: "@autodig outgroup:restControllers"})}, dig.Group("restControllers"))
 }
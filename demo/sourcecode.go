@@ -1,5 +1,7 @@
 package demo
 
+//go:generate go run github.com/cindyoshinee/autodig
+
 type ControllerI interface {
 }
 
@@ -0,0 +1,79 @@
+package dep
+
+import "go/ast"
+
+// Annotation 解析后的@autodig注释，供analyzer等外部工具复用生成时的解析规则
+type Annotation struct {
+	OutGroup string
+	Tag      string
+	Name     string
+	Problems []AnnotationProblem
+}
+
+// FieldAnnotation 解析后的struct field autodig tag
+type FieldAnnotation struct {
+	Ignore   bool
+	IsReturn bool
+	InGroup  string
+	Name     string
+	Problems []AnnotationProblem
+}
+
+// AnnotationProblem 注释或tag中无法识别或格式错误的部分
+type AnnotationProblem struct {
+	Key string
+	// Offset Key在注释文本/tag原文中的偏移, -1表示未知
+	Offset int
+	Msg    string
+	// Suggestion 可能想写的key, 为空表示没有建议
+	Suggestion string
+}
+
+// ParseAnnotation 解析一行注释，不是@autodig注释时返回nil
+func ParseAnnotation(text string) *Annotation {
+	comment := parseComment(text)
+	if comment == nil {
+		return nil
+	}
+	return &Annotation{
+		OutGroup: comment.outGroup,
+		Tag:      comment.tag,
+		Name:     comment.name,
+		Problems: exportProblems(comment.problems),
+	}
+}
+
+// ParseFieldAnnotation 解析struct field上的autodig tag
+func ParseFieldAnnotation(field *ast.Field) *FieldAnnotation {
+	info := parseFieldInfo(field)
+	return &FieldAnnotation{
+		Ignore:   info.ignore,
+		IsReturn: info.isReturn,
+		InGroup:  info.inGroup,
+		Name:     info.name,
+		Problems: exportProblems(info.problems),
+	}
+}
+
+// FindAnnotation 返回doc中第一条@autodig注释
+func FindAnnotation(doc *ast.CommentGroup) (*ast.Comment, *Annotation) {
+	node, comment := findComment(doc)
+	if comment == nil {
+		return nil, nil
+	}
+	return node, ParseAnnotation(node.Text)
+}
+
+// IsInGroupType ingroup字段的类型是否合法, dig的value group只能注入到slice中, 数组[N]T也不行
+func IsInGroupType(expr ast.Expr) bool {
+	arrayType, ok := expr.(*ast.ArrayType)
+	return ok && arrayType.Len == nil
+}
+
+func exportProblems(problems []*annotationProblem) []AnnotationProblem {
+	ret := make([]AnnotationProblem, 0, len(problems))
+	for _, each := range problems {
+		ret = append(ret, AnnotationProblem{Key: each.key, Offset: each.offset, Msg: each.msg, Suggestion: each.suggestion})
+	}
+	return ret
+}
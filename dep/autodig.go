@@ -2,56 +2,311 @@ package dep
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/printer"
 	"go/token"
+	"hash"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 
 	"golang.org/x/tools/imports"
 )
 
+const (
+	// OutputModeSingle 所有构造函数生成到一个文件中
+	OutputModeSingle = "single"
+	// OutputModePackage 每个包生成自己的autodig_gen.go, 输出文件只负责调用各个包的Register
+	OutputModePackage = "package"
+)
+
 type Autodig struct {
 	importHandler ImportHandler
 	scanDirs      []string
 	outputDir     string
 	cmdTag        string
+	maxErrors     int
+	strict        bool
+	mode          string
+	excludes      []string
+	includes      []string
+	runtimePath   string
+	buildEnv      BuildEnv
+	naming        Naming
+	fakes         bool
+	lineDirective bool
+	cacheDir      string
+	cache         *loadCache
+	sources       *sourceSet
+	goGenerate    bool
+	diags         *Diagnostics
+	providers     []*Provider
+}
+
+// genFile 一个生成的文件
+type genFile struct {
+	path    string
+	content []byte
 }
 
 func NewAutodig(scanDirs []string, outputDir string, cmdTag string) *Autodig {
-	return &Autodig{importHandler: NewImportHandler(), scanDirs: scanDirs, outputDir: outputDir, cmdTag: cmdTag}
+	return &Autodig{importHandler: NewImportHandler("", BuildEnv{}), scanDirs: scanDirs, outputDir: outputDir, cmdTag: cmdTag, diags: NewDiagnostics(0)}
+}
+
+// SetMaxErrors 达到maxErrors个错误后停止处理, <= 0表示不限制
+func (a *Autodig) SetMaxErrors(maxErrors int) *Autodig {
+	a.maxErrors = maxErrors
+	a.diags = NewDiagnostics(maxErrors)
+	return a
+}
+
+// SetStrict strict模式下注释/tag中无法识别的key、缺少值的key、无法处理的声明都会作为error报告
+func (a *Autodig) SetStrict(strict bool) *Autodig {
+	a.strict = strict
+	return a
+}
+
+// SetMode OutputModeSingle或OutputModePackage, 默认OutputModeSingle
+func (a *Autodig) SetMode(mode string) *Autodig {
+	a.mode = mode
+	return a
+}
+
+// SetExcludes 扫描时跳过匹配pattern的文件和目录, 匹配规则见matchAny
+func (a *Autodig) SetExcludes(excludes []string) *Autodig {
+	a.excludes = excludes
+	return a
+}
+
+// SetIncludes 默认跳过带有"// Code generated ... DO NOT EDIT."注释的文件, 匹配includes的生成文件仍然会被扫描
+func (a *Autodig) SetIncludes(includes []string) *Autodig {
+	a.includes = includes
+	return a
+}
+
+// SetRuntimePackage 生成代码调用path包的MustProvide/ProvideTo/WithSource等函数, 而不是dep包.
+// path包需要提供和dep包相同签名的函数
+func (a *Autodig) SetRuntimePackage(path string) *Autodig {
+	a.runtimePath = path
+	a.importHandler = NewImportHandler(path, a.buildEnv)
+	return a
+}
+
+// SetBuildEnv 只扫描在env下满足build constraints(//go:build、_linux.go后缀等)的文件
+func (a *Autodig) SetBuildEnv(env BuildEnv) *Autodig {
+	a.buildEnv = env
+	a.importHandler = NewImportHandler(a.runtimePath, env)
+	return a
+}
+
+// SetNaming 设置生成函数的命名模板
+func (a *Autodig) SetNaming(naming Naming) *Autodig {
+	a.naming = naming
+	return a
+}
+
+// SetFakes 为DigReturn和被注入的interface生成fake实现到autodig_fake.go, -tag mock时注册fake替换生产代码的实现
+func (a *Autodig) SetFakes(fakes bool) *Autodig {
+	a.fakes = fakes
+	return a
+}
+
+// SetLineDirectives 在生成的声明前加上//line, panic的调用栈会指向@autodig所在的源码而不是生成文件
+func (a *Autodig) SetLineDirectives(lineDirective bool) *Autodig {
+	a.lineDirective = lineDirective
+	return a
+}
+
+// SetGoGenerate 通过//go:generate调用时, 有自己的//go:generate autodig指令的子目录由该指令生成, 扫描时跳过
+func (a *Autodig) SetGoGenerate(goGenerate bool) *Autodig {
+	a.goGenerate = goGenerate
+	return a
+}
+
+// SetCacheDir 在dir下缓存加载包得到的包名和文件列表, 未变化的包不会重新加载. 为空时不使用缓存, 见DefaultCacheDir
+func (a *Autodig) SetCacheDir(dir string) *Autodig {
+	a.cacheDir = dir
+	return a
+}
+
+// OutputFile 输出文件的绝对路径, 生成之后可用
+func (a *Autodig) OutputFile() string {
+	return a.outputDir
+}
+
+// Diagnostics 返回最近一次生成过程中收集到的所有错误和警告
+func (a *Autodig) Diagnostics() *Diagnostics {
+	return a.diags
+}
+
+// Providers 返回最近一次生成过程中扫描到的所有provider
+func (a *Autodig) Providers() []*Provider {
+	return a.providers
+}
+
+// Report 分析最近一次生成的依赖关系，列出没有被使用的provider、没有成员的group和没有provider的name
+func (a *Autodig) Report() *GraphReport {
+	return BuildGraphReport(a.providers)
 }
 
 func (a *Autodig) GenDigFile() error {
+	a.diags = NewDiagnostics(a.maxErrors)
 	err := a.handleParam()
 	if err != nil {
 		return err
 	}
-	err = os.Remove(a.outputDir)
+	genFiles, staleFiles, err := a.generate(context.Background())
 	if err != nil {
-		fmt.Println("delete autodig file errrrrr", err.Error())
-	}
-	decls, outputPkgName, err := a.genDecls()
-	if err != nil {
-		fmt.Println(err)
 		return err
 	}
-	outputfile, err := os.Create(a.outputDir)
+	for _, file := range genFiles {
+		err = writeIfChanged(file)
+		if err != nil {
+			return err
+		}
+	}
+	// 包中已经没有@autodig了, 删除之前生成的文件
+	for _, file := range staleFiles {
+		err = os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIfChanged 内容没有变化时不重写文件, 保持mtime不变, 避免构建缓存失效.
+// 先写入同目录下的临时文件再rename覆盖, 任何一步失败都会保留原来的文件
+func writeIfChanged(file *genFile) error {
+	old, err := ioutil.ReadFile(file.path)
+	if err == nil && bytes.Equal(old, file.content) {
+		return nil
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(file.path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(file.path), "."+filepath.Base(file.path)+".*.tmp")
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return fmt.Errorf("create temp file err: %v", err)
+	}
+	tmpPath := tmpFile.Name()
+	_, err = tmpFile.Write(file.content)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, file.path)
 	}
-	defer outputfile.Close()
-	err = a.write(outputfile, outputPkgName, decls)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write %s err: %v", file.path, err)
 	}
 	return nil
 }
 
+// GeneratedFile 生成的文件
+type GeneratedFile struct {
+	Path    string
+	Content []byte
+}
+
+// Generate 在内存中生成所有文件, 不写入磁盘也不输出日志. stale为之前生成但现在应该删除的文件.
+// ctx取消后停止加载包并返回ctx.Err()
+func (a *Autodig) Generate(ctx context.Context) (files []*GeneratedFile, stale []string, err error) {
+	a.diags = NewDiagnostics(a.maxErrors)
+	err = a.handleParam()
+	if err != nil {
+		return nil, nil, err
+	}
+	genFiles, stale, err := a.generate(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range genFiles {
+		files = append(files, &GeneratedFile{Path: file.path, Content: file.content})
+	}
+	return files, stale, nil
+}
+
+// CheckResult autodig check的结果
+type CheckResult struct {
+	OutputFile string
+	Stale      bool
+	// Reasons 说明生成文件过期的原因
+	Reasons []string
+	// Diff 磁盘上的文件与重新生成内容的unified diff
+	Diff string
+}
+
+// Check 在内存中重新生成并与磁盘上的文件比较，不会修改文件
+func (a *Autodig) Check() (*CheckResult, error) {
+	a.diags = NewDiagnostics(a.maxErrors)
+	err := a.handleParam()
+	if err != nil {
+		return nil, err
+	}
+	genFiles, staleFiles, err := a.generate(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{OutputFile: a.outputDir}
+	for _, file := range genFiles {
+		old, err := ioutil.ReadFile(file.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if bytes.Equal(old, file.content) {
+			continue
+		}
+		result.Stale = true
+		result.Diff += UnifiedDiff(file.path, file.path+" (regenerated)", old, file.content)
+		if old == nil {
+			result.Reasons = append(result.Reasons, fmt.Sprintf("%s: output file does not exist", file.path))
+			continue
+		}
+		for _, reason := range staleReasons(parseHeader(old), parseHeader(file.content)) {
+			result.Reasons = append(result.Reasons, fmt.Sprintf("%s: %s", file.path, reason))
+		}
+	}
+	for _, file := range staleFiles {
+		result.Stale = true
+		result.Reasons = append(result.Reasons, fmt.Sprintf("%s: package has no @autodig declarations any more, the file should be deleted", file))
+	}
+	return result, nil
+}
+
+func staleReasons(old, current *fileHeader) []string {
+	reasons := make([]string, 0)
+	if old.version != current.version {
+		reasons = append(reasons, fmt.Sprintf("generated by autodig %s, current version is %s", orUnknown(old.version), current.version))
+	}
+	if old.inputHash != current.inputHash {
+		reasons = append(reasons, "annotated sources or generate options changed since the file was generated")
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "annotations are unchanged but the content differs, the file may have been edited by hand or a type it depends on changed")
+	}
+	return reasons
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown version"
+	}
+	return s
+}
+
 func (a *Autodig) handleParam() error {
 	err := a.absParam()
 	if err != nil {
@@ -87,29 +342,277 @@ func (a *Autodig) absParam() error {
 	return nil
 }
 
-func (a *Autodig) genDecls() ([]ast.Decl, string, error) {
-	files, err := a.getAllFiles(a.scanDirs)
+// generate 生成所有autodig文件的内容，不写入磁盘. staleFiles为之前生成但现在应该删除的文件
+func (a *Autodig) generate(ctx context.Context) (genFiles []*genFile, staleFiles []string, err error) {
+	files, testFiles, err := a.getAllFiles(a.scanDirs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getAllFiles err: %v ", err)
+	}
+	files = removeString(files, a.outputDir)
+	files, existGenFiles := splitPackageGenFiles(files)
+	// 没有@autodig的文件不会生成任何代码, 之后只解析和加载有@autodig的文件
+	files, err = annotatedFiles(files)
 	if err != nil {
-		return nil, "", fmt.Errorf("getAllFiles err: %v ", err)
+		return nil, nil, err
+	}
+	a.cache = openLoadCache(a.cacheDir, a.buildEnv, a.outputDir)
+	defer a.cache.save()
+	a.sources = newSourceSet(a.cache)
+	if handler, ok := a.importHandler.(*importHandler); ok {
+		handler.cache = a.cache
+		handler.sources = a.sources
+		handler.ctx = ctx
+		handler.dir = moduleRoot(filepath.Dir(a.outputDir))
+		// 所有文件只解析一次, 所有相关的包一次加载
+		handler.preload(files, a.outputDir)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	a.providers = nil
+	if a.mode == OutputModePackage {
+		genFiles, err = a.generatePackages(files)
+	} else {
+		var file *genFile
+		file, a.providers, err = a.generateFile(files, a.outputDir, false, a.diags)
+		genFiles = []*genFile{file}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// 跨包检查重复的provider
+	checkDuplicateProviders(a.providers, a.diags)
+	if err := a.diags.Err(); err != nil {
+		return nil, nil, fmt.Errorf("buildDecls err: %v ", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	fakeFile := filepath.Join(filepath.Dir(a.outputDir), FakeOutputFileName)
+	if a.fakes {
+		file, err := a.generateFakeFile(files)
+		if err != nil {
+			return nil, nil, err
+		}
+		if file != nil {
+			genFiles = append(genFiles, file)
+		}
 	}
-	// 第一次遍历，获取所有imports和imports别名
-	importCtx, err := a.importHandler.GetAllImports(files, a.outputDir)
+	if !containsGenFile(genFiles, fakeFile) {
+		if generated, err := isAutodigFile(fakeFile); err != nil {
+			return nil, nil, err
+		} else if generated {
+			staleFiles = append(staleFiles, fakeFile)
+		}
+	}
+	testFile, err := a.generateTestFile(testFiles, files)
 	if err != nil {
-		return nil, "", fmt.Errorf("getAllImports err: %v ", err)
+		return nil, nil, err
+	}
+	if err := a.diags.Err(); err != nil {
+		return nil, nil, fmt.Errorf("buildDecls err: %v ", err)
 	}
-	// 第二次遍历, 构建方法们
-	decls, err := NewFileBuilder(importCtx).BuildDecls(files, importCtx, a.cmdTag)
+	if testFile != nil {
+		genFiles = append(genFiles, testFile)
+	} else if generated, err := isAutodigFile(a.testOutputFile()); err != nil {
+		return nil, nil, err
+	} else if generated {
+		staleFiles = append(staleFiles, a.testOutputFile())
+	}
+	for _, file := range existGenFiles {
+		if !containsGenFile(genFiles, file) {
+			staleFiles = append(staleFiles, file)
+		}
+	}
+	return genFiles, staleFiles, nil
+}
+
+// generateFile 根据files生成outputFile, register为true时生成Register函数而不是init.
+// 错误和警告记录到diags中, 返回生成的文件和其中的provider
+func (a *Autodig) generateFile(files []string, outputFile string, register bool, diags *Diagnostics) (*genFile, []*Provider, error) {
+	decls, providers, outputPkgName, inputHash, err := a.genDecls(files, outputFile, register, diags)
 	if err != nil {
-		return nil, "", fmt.Errorf("buildDecls err: %v ", err)
+		return nil, providers, err
+	}
+	buffer := &bytes.Buffer{}
+	err = a.write(buffer, &fileHeader{pkgName: outputPkgName, version: Version, inputHash: inputHash}, decls)
+	if err != nil {
+		return nil, providers, err
+	}
+	return a.newGenFile(outputFile, buffer.Bytes(), providers), providers, nil
+}
+
+func annotatedFiles(files []string) ([]string, error) {
+	ret := make([]string, 0, len(files))
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Contains(content, []byte("@autodig")) {
+			ret = append(ret, file)
+		}
+	}
+	return ret, nil
+}
+
+func (a *Autodig) newGenFile(path string, content []byte, providers []*Provider) *genFile {
+	if a.lineDirective {
+		content = addLineDirectives(content, path, providers)
+	}
+	return &genFile{path: path, content: content}
+}
+
+func (a *Autodig) genDecls(files []string, outputFile string, register bool, diags *Diagnostics) ([]ast.Decl, []*Provider, string, string, error) {
+	inputHash := a.hashInputs(files, outputFile)
+	// 获取所有imports和imports别名, 文件在这里解析, 之后共用同一份AST
+	importCtx, err := a.importHandler.GetAllImports(files, outputFile)
+	if err != nil {
+		return nil, nil, "", "", fmt.Errorf("getAllImports err: %v ", err)
+	}
+	// 构建方法们
+	fileBuilder := NewFileBuilder(importCtx, diags, BuildOptions{Strict: a.strict, Register: register, Naming: a.naming})
+	decls, err := fileBuilder.BuildDecls(files, importCtx, a.cmdTag)
+	if err != nil {
+		return nil, fileBuilder.Providers(), "", "", fmt.Errorf("buildDecls err: %v ", err)
+	}
+	return decls, fileBuilder.Providers(), importCtx.outputPkgName, inputHash, nil
+}
+
+// hashInputs 计算生成参数和输入文件中影响生成内容的部分的hash: 包名、imports、带@autodig的声明(func不含函数体)及其行号、Init方法的签名.
+// 修改函数体、没有@autodig的声明或者其他文件不会改变hash. 文件路径使用相对输出文件的路径，保证不同机器上结果一致
+func (a *Autodig) hashInputs(files []string, outputFile string) string {
+	outputDir := filepath.Dir(outputFile)
+	sorted := make([]string, len(files))
+	copy(sorted, files)
+	sort.Strings(sorted)
+	hash := a.newInputHash()
+	for _, file := range sorted {
+		rel, err := filepath.Rel(outputDir, file)
+		if err != nil {
+			rel = file
+		}
+		fmt.Fprintf(hash, "file:%s\n", filepath.ToSlash(rel))
+		hashFileDecls(hash, a.sources, file)
+	}
+	return fmt.Sprintf("sha256:%x", hash.Sum(nil))
+}
+
+// hashPackages package模式的输出文件只调用各个包的Register, 只和包所在的目录有关
+func (a *Autodig) hashPackages(dirs []string, outputFile string) string {
+	hash := a.newInputHash()
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(filepath.Dir(outputFile), dir)
+		if err != nil {
+			rel = dir
+		}
+		fmt.Fprintf(hash, "package:%s\n", filepath.ToSlash(rel))
+	}
+	return fmt.Sprintf("sha256:%x", hash.Sum(nil))
+}
+
+func (a *Autodig) newInputHash() hash.Hash {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "tag:%s\n", a.cmdTag)
+	if a.lineDirective {
+		fmt.Fprintf(hash, "line directives\n")
+	}
+	// 运行时包和命名模板会改变生成内容, 使用默认值时不计入, 保持之前生成文件的hash不变
+	if a.runtimePath != "" {
+		fmt.Fprintf(hash, "runtime:%s\n", a.runtimePath)
 	}
-	return decls, importCtx.outputPkgName, nil
+	if a.naming != (Naming{}) {
+		fmt.Fprintf(hash, "naming:%s|%s\n", a.naming.Struct, a.naming.Func)
+	}
+	return hash
+}
+
+// hashFileDecls 解析失败时生成也会失败, 只记录错误
+func hashFileDecls(w io.Writer, sources *sourceSet, file string) {
+	parsed := sources.get(file)
+	if parsed.err != nil {
+		fmt.Fprintf(w, "error:%v\n", parsed.err)
+		return
+	}
+	fileAST := parsed.ast
+	fmt.Fprintf(w, "package:%s\n", fileAST.Name.Name)
+	for _, spec := range fileAST.Imports {
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		fmt.Fprintf(w, "import:%s %s\n", name, spec.Path.Value)
+	}
+	for _, decl := range fileAST.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if !hasAutodigComment(decl.Doc) {
+				continue
+			}
+			fmt.Fprintf(w, "decl:%d:%s\n", sources.fset.Position(decl.Pos()).Line, decl.Doc.Text())
+			_ = printer.Fprint(w, sources.fset, stripComments(decl))
+		case *ast.FuncDecl:
+			isInit := decl.Name.Name == "Init" && decl.Recv != nil
+			if !isInit && !hasAutodigComment(decl.Doc) {
+				continue
+			}
+			fmt.Fprintf(w, "func:%d:%s\n", sources.fset.Position(decl.Pos()).Line, decl.Doc.Text())
+			signature := *decl
+			signature.Doc, signature.Body = nil, nil
+			_ = printer.Fprint(w, sources.fset, &signature)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// stripComments 拷贝decl并去掉字段上的注释, 注释不影响生成内容
+func stripComments(decl *ast.GenDecl) ast.Decl {
+	clone := cloneDecl(decl).(*ast.GenDecl)
+	clone.Doc = nil
+	ast.Inspect(clone, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Field:
+			node.Doc, node.Comment = nil, nil
+		case *ast.TypeSpec:
+			node.Doc, node.Comment = nil, nil
+		case *ast.ValueSpec:
+			node.Doc, node.Comment = nil, nil
+		}
+		return true
+	})
+	return clone
 }
 
-func (a *Autodig) write(wr io.Writer, pkgName string, funcs []ast.Decl) error {
-	header := fmt.Sprintf(`// Code generated by autodig. DO NOT EDIT.
+type fileHeader struct {
+	pkgName   string
+	version   string
+	inputHash string
+}
+
+var (
+	headerVersionReg = regexp.MustCompile(`(?m)^// autodig version: (\S+)$`)
+	headerInputsReg  = regexp.MustCompile(`(?m)^// autodig inputs: (\S+)$`)
+)
+
+func parseHeader(content []byte) *fileHeader {
+	header := &fileHeader{}
+	if match := headerVersionReg.FindSubmatch(content); match != nil {
+		header.version = string(match[1])
+	}
+	if match := headerInputsReg.FindSubmatch(content); match != nil {
+		header.inputHash = string(match[1])
+	}
+	return header
+}
+
+func (a *Autodig) write(wr io.Writer, header *fileHeader, funcs []ast.Decl) error {
+	headerText := fmt.Sprintf(`// Code generated by autodig. DO NOT EDIT.
+// autodig version: %s
+// autodig inputs: %s
+
 package %s
-`, pkgName)
-	buffer := bytes.NewBufferString(header)
+`, header.version, header.inputHash, header.pkgName)
+	buffer := bytes.NewBufferString(headerText)
 	for _, fn := range funcs {
 		err := a.astToGo(buffer, fn)
 		if err != nil {
@@ -121,7 +624,6 @@ package %s
 	if err != nil {
 		return err
 	}
-	// bytes := buffer.Bytes()
 	_, err = wr.Write(bytes)
 	return err
 }
@@ -139,6 +641,16 @@ func (a *Autodig) astToGo(dst *bytes.Buffer, node interface{}) error {
 		return err
 	}
 
+	// 生成的decl没有位置信息, printer无法输出Doc, 手动输出后再打印不带Doc的decl
+	if funcDecl, ok := node.(*ast.FuncDecl); ok && funcDecl.Doc != nil {
+		for _, comment := range funcDecl.Doc.List {
+			dst.WriteString(comment.Text)
+			dst.WriteByte('\n')
+		}
+		withoutDoc := *funcDecl
+		withoutDoc.Doc = nil
+		node = &withoutDoc
+	}
 	err = format.Node(dst, token.NewFileSet(), node)
 	if err != nil {
 		return err
@@ -155,6 +667,32 @@ func containsString(slice []string, target string) bool {
 	return false
 }
 
+func removeString(slice []string, target string) []string {
+	ret := make([]string, 0, len(slice))
+	for _, each := range slice {
+		if each != target {
+			ret = append(ret, each)
+		}
+	}
+	return ret
+}
+
+// moduleRelPath 返回file相对所在module根目录(go.mod所在目录)的路径, 找不到go.mod时返回文件名
+func moduleRelPath(file string) string {
+	for dir := filepath.Dir(file); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			if rel, err := filepath.Rel(dir, file); err == nil {
+				return filepath.ToSlash(rel)
+			}
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return filepath.Base(file)
+}
+
 func absPath(path string) (string, error) {
 	if filepath.IsAbs(path) {
 		return path, nil
@@ -0,0 +1,152 @@
+package dep
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const stableSource = `package stable
+
+type Client struct {
+}
+
+// @autodig
+func NewClient() *Client {
+	return &Client{}
+}
+
+// @autodig
+type Service struct {
+	Client *Client // 注入
+	config string
+}
+
+func helper() string {
+	return "a"
+}
+`
+
+// generateIn 在dir中生成, 返回输出文件的内容
+func generateIn(t *testing.T, dir string) []byte {
+	files, _, err := NewAutodig([]string{dir}, dir, "").Generate(context.Background())
+	if err != nil {
+		t.Fatalf("Generate() err: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Generate() got %d files, want 1", len(files))
+	}
+	return files[0].Content
+}
+
+func TestGenerateStableAfterUnrelatedEdit(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(dir string) error
+	}{
+		{
+			name: "func body",
+			edit: func(dir string) error {
+				return replaceInFile(filepath.Join(dir, "stable.go"), `return "a"`, `return "b"`)
+			},
+		},
+		{
+			name: "annotated func body",
+			edit: func(dir string) error {
+				return replaceInFile(filepath.Join(dir, "stable.go"), "return &Client{}", "return new(Client)")
+			},
+		},
+		{
+			name: "field comment",
+			edit: func(dir string) error {
+				return replaceInFile(filepath.Join(dir, "stable.go"), "// 注入", "// 自动注入")
+			},
+		},
+		{
+			name: "file without annotation",
+			edit: func(dir string) error {
+				return ioutil.WriteFile(filepath.Join(dir, "other.go"), []byte("package stable\n\nfunc other() {}\n"), 0644)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 输出目录需要在module内, 才能得到它的import path
+			dir := filepath.Join(newTestModule(t, map[string]string{"stable/stable.go": stableSource}), "stable")
+			before := generateIn(t, dir)
+			if err := tt.edit(dir); err != nil {
+				t.Fatal(err)
+			}
+			if after := generateIn(t, dir); !bytes.Equal(before, after) {
+				t.Errorf("output changed after unrelated edit:\n%s", UnifiedDiff("before", "after", before, after))
+			}
+		})
+	}
+}
+
+func replaceInFile(path, old, new string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(content), old) {
+		return os.ErrNotExist
+	}
+	return ioutil.WriteFile(path, []byte(strings.Replace(string(content), old, new, 1)), 0644)
+}
+
+func TestWriteIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "autodig.go")
+	if err := ioutil.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeIfChanged(&genFile{path: path, content: []byte("new")}); err != nil {
+		t.Fatalf("writeIfChanged() err: %v", err)
+	}
+	content, _ := ioutil.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(content) != "new" || info.Mode().Perm() != 0600 {
+		t.Errorf("after write: content %q, perm %v, want \"new\" with the old perm 0600", content, info.Mode().Perm())
+	}
+
+	// 写入失败(这里是rename到一个非空目录)时原来的内容不变, 也不会留下临时文件
+	target := filepath.Join(dir, "target.go")
+	if err := os.MkdirAll(filepath.Join(target, "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeIfChanged(&genFile{path: target, content: []byte("new")}); err == nil {
+		t.Fatalf("writeIfChanged() err = nil, want a rename error")
+	}
+	if info, err := os.Stat(filepath.Join(target, "keep")); err != nil || !info.IsDir() {
+		t.Errorf("old target was modified: %v", err)
+	}
+
+	// 目录不可写时无法创建临时文件, 原文件不变. root不受权限限制
+	if os.Geteuid() != 0 {
+		if err := os.Chmod(dir, 0555); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(dir, 0755)
+		if err := writeIfChanged(&genFile{path: path, content: []byte("newer")}); err == nil {
+			t.Errorf("writeIfChanged() in a read-only dir err = nil")
+		}
+		if content, _ := ioutil.ReadFile(path); string(content) != "new" {
+			t.Errorf("content = %q after a failed write, want \"new\"", content)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temp file %s left behind", entry.Name())
+		}
+	}
+}
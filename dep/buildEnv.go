@@ -0,0 +1,55 @@
+package dep
+
+import (
+	"go/build"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// BuildEnv 选择文件时使用的GOOS/GOARCH和build tags, 与go build的语义相同. 为空的字段使用当前环境的值
+type BuildEnv struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string
+}
+
+func (e BuildEnv) context() build.Context {
+	ctx := build.Default
+	if e.GOOS != "" {
+		ctx.GOOS = e.GOOS
+	}
+	if e.GOARCH != "" {
+		ctx.GOARCH = e.GOARCH
+	}
+	// 交叉编译时go build默认关闭cgo
+	if ctx.GOOS != build.Default.GOOS || ctx.GOARCH != build.Default.GOARCH {
+		ctx.CgoEnabled = false
+	}
+	ctx.BuildTags = append(append([]string{}, build.Default.BuildTags...), e.Tags...)
+	return ctx
+}
+
+// matchFile 文件的//go:build、// +build和_GOOS_GOARCH后缀是否满足当前环境
+func (e BuildEnv) matchFile(dir, name string) (bool, error) {
+	ctx := e.context()
+	return ctx.MatchFile(dir, name)
+}
+
+func (e BuildEnv) packagesConfig(mode packages.LoadMode) *packages.Config {
+	config := &packages.Config{Mode: mode}
+	if e.GOOS != "" || e.GOARCH != "" {
+		config.Env = os.Environ()
+		if e.GOOS != "" {
+			config.Env = append(config.Env, "GOOS="+e.GOOS)
+		}
+		if e.GOARCH != "" {
+			config.Env = append(config.Env, "GOARCH="+e.GOARCH)
+		}
+	}
+	if len(e.Tags) > 0 {
+		config.BuildFlags = []string{"-tags=" + strings.Join(e.Tags, ",")}
+	}
+	return config
+}
@@ -0,0 +1,349 @@
+package dep
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// DefaultCacheDir 默认的缓存目录, $XDG_CACHE_HOME/autodig或系统对应的用户缓存目录, 获取失败时返回空字符串
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "autodig")
+}
+
+// loadCache 缓存packages.Load得到的包名和文件列表. 缓存文件以Go环境和go.mod/go.sum内容为key,
+// module内的包还会记录目录下go文件内容的hash, 文件变化后重新加载. file为空时只缓存在内存中, nil表示不使用缓存
+type loadCache struct {
+	mu      sync.Mutex
+	file    string
+	root    string
+	entries map[string]*cachedPackage
+	impls   map[string]*cachedImpl
+	files   map[string]*cachedFile
+	// stamps 本次生成中已经计算过的目录hash
+	stamps map[string]string
+	dirty  bool
+}
+
+type cacheContent struct {
+	Packages map[string]*cachedPackage `json:"packages"`
+	Impls    map[string]*cachedImpl    `json:"impls"`
+	Files    map[string]*cachedFile    `json:"files"`
+}
+
+type cachedPackage struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Dir     string   `json:"dir"`
+	GoFiles []string `json:"go_files"`
+	// Stamp module内的包目录下go文件内容的hash, 其他包(标准库、module cache)为空
+	Stamp string `json:"stamp,omitempty"`
+}
+
+// cachedImpl DigReturn的检查结果, Stamps为相关声明所在的module内目录的hash
+type cachedImpl struct {
+	IfaceName    string            `json:"iface_name"`
+	Missing      []string          `json:"missing,omitempty"`
+	NotInterface bool              `json:"not_interface,omitempty"`
+	Stamps       map[string]string `json:"stamps,omitempty"`
+}
+
+// cachedFile 输入文件中与生成有关的内容的位置, 见sourceSet.parseFile. Hash为文件内容的sha256
+type cachedFile struct {
+	Hash string   `json:"hash"`
+	Keep [][2]int `json:"keep"`
+}
+
+// openLoadCache 没有缓存目录或缓存不可用时返回只在本次生成中使用的内存缓存, 不影响生成
+func openLoadCache(cacheDir string, env BuildEnv, outputFile string) *loadCache {
+	cache := &loadCache{entries: make(map[string]*cachedPackage), impls: make(map[string]*cachedImpl), files: make(map[string]*cachedFile), stamps: make(map[string]string)}
+	if cacheDir == "" {
+		return cache
+	}
+	root := moduleRoot(filepath.Dir(outputFile))
+	if root == "" {
+		return cache
+	}
+	key, err := cacheKey(env, root)
+	if err != nil {
+		return cache
+	}
+	cache.file, cache.root = filepath.Join(cacheDir, key+".json"), root
+	content, err := ioutil.ReadFile(cache.file)
+	if err != nil {
+		return cache
+	}
+	// 缓存损坏时当作空缓存
+	saved := &cacheContent{}
+	if json.Unmarshal(content, saved) == nil {
+		if saved.Packages != nil {
+			cache.entries = saved.Packages
+		}
+		if saved.Impls != nil {
+			cache.impls = saved.Impls
+		}
+		if saved.Files != nil {
+			cache.files = saved.Files
+		}
+	}
+	return cache
+}
+
+// cacheKey Go版本、GOOS/GOARCH/tags、GOFLAGS、GOROOT/GOPATH和go.mod/go.sum内容都会影响加载结果
+func cacheKey(env BuildEnv, root string) (string, error) {
+	ctx := env.context()
+	hash := sha256.New()
+	fmt.Fprintf(hash, "autodig:%s\ngo:%s\nroot:%s\n", Version, runtime.Version(), root)
+	fmt.Fprintf(hash, "goos:%s\ngoarch:%s\ncgo:%v\ntags:%s\n", ctx.GOOS, ctx.GOARCH, ctx.CgoEnabled, strings.Join(ctx.BuildTags, ","))
+	fmt.Fprintf(hash, "goflags:%s\ngoroot:%s\ngopath:%s\n", os.Getenv("GOFLAGS"), build.Default.GOROOT, build.Default.GOPATH)
+	for _, name := range []string{"go.mod", "go.sum"} {
+		content, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s:%d\n", name, len(content))
+		hash.Write(content)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))[:32], nil
+}
+
+func (c *loadCache) get(key string) *cachedPackage {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if c.file != "" && entry.Stamp != "" && entry.Stamp != c.stamp(entry.Dir) {
+		return nil
+	}
+	return entry
+}
+
+func (c *loadCache) put(key string, pkg *packages.Package) *cachedPackage {
+	entry := &cachedPackage{ID: pkg.ID, Name: pkg.Name, GoFiles: pkg.GoFiles}
+	if len(pkg.GoFiles) > 0 {
+		entry.Dir = filepath.Dir(pkg.GoFiles[0])
+	}
+	// 有错误的包不缓存, 下次重新加载
+	if c == nil || len(pkg.Errors) > 0 || entry.Dir == "" {
+		return entry
+	}
+	if c.file != "" && c.inModule(entry.Dir) {
+		entry.Stamp = c.stamp(entry.Dir)
+	}
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.dirty = true
+	c.mu.Unlock()
+	return entry
+}
+
+func (c *loadCache) getImpl(key string) *cachedImpl {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	entry, ok := c.impls[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	for dir, stamp := range entry.Stamps {
+		if c.file != "" && c.stamp(dir) != stamp {
+			return nil
+		}
+	}
+	return entry
+}
+
+// putImpl 只记录module内目录的hash, module外的代码由go.mod/go.sum决定. 内存缓存不需要hash
+func (c *loadCache) putImpl(key string, entry *cachedImpl, dirs map[string]bool) {
+	if c == nil {
+		return
+	}
+	entry.Stamps = make(map[string]string)
+	for dir := range dirs {
+		if c.file != "" && c.inModule(dir) {
+			entry.Stamps[dir] = c.stamp(dir)
+		}
+	}
+	c.mu.Lock()
+	c.impls[key] = entry
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+// getFile 文件内容的hash相同时返回缓存的位置, size用于检查缓存是否损坏
+func (c *loadCache) getFile(file string, hash string, size int) [][2]int {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	entry, ok := c.files[file]
+	c.mu.Unlock()
+	if !ok || entry.Hash != hash || len(entry.Keep) == 0 {
+		return nil
+	}
+	for _, each := range entry.Keep {
+		if each[0] < 0 || each[0] > each[1] || each[1] > size {
+			return nil
+		}
+	}
+	return entry.Keep
+}
+
+// putFile 以文件路径为key, 文件修改后覆盖之前的记录
+func (c *loadCache) putFile(file string, entry *cachedFile) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.files[file] = entry
+	c.dirty = true
+	c.mu.Unlock()
+}
+
+func (c *loadCache) inModule(dir string) bool {
+	return dir == c.root || strings.HasPrefix(dir, c.root+string(os.PathSeparator))
+}
+
+// stamp 目录下所有go文件的名字和内容的hash, 每个目录在一次生成中只计算一次
+func (c *loadCache) stamp(dir string) string {
+	c.mu.Lock()
+	stamp, ok := c.stamps[dir]
+	c.mu.Unlock()
+	if !ok {
+		stamp = hashGoFiles(dir)
+		c.mu.Lock()
+		c.stamps[dir] = stamp
+		c.mu.Unlock()
+	}
+	return stamp
+}
+
+func hashGoFiles(dir string) string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "missing"
+	}
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+	hash := sha256.New()
+	for _, name := range names {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "missing"
+		}
+		fmt.Fprintf(hash, "%s:%d\n", name, len(content))
+		hash.Write(content)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// save 有新的内容时写回缓存文件, 失败时忽略
+func (c *loadCache) save() {
+	if c == nil || c.file == "" || !c.dirty {
+		return
+	}
+	c.mu.Lock()
+	content, err := json.Marshal(&cacheContent{Packages: c.entries, Impls: c.impls, Files: c.files})
+	c.mu.Unlock()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.file), 0755); err != nil {
+		return
+	}
+	_ = writeIfChanged(&genFile{path: c.file, content: content})
+}
+
+// loadPackages 一次加载dirs目录下的包和paths对应的包, 缓存中已有的包不再加载.
+// 加载失败的目录不会出现在结果中, paths中的包有错误时返回error
+func (h *importHandler) loadPackages(dirs []string, paths []string) (byDir map[string]*cachedPackage, byPath map[string]*cachedPackage, err error) {
+	byDir = make(map[string]*cachedPackage)
+	byPath = make(map[string]*cachedPackage)
+	wantDirs := make(map[string]bool)
+	wantPaths := make(map[string]bool)
+	patterns := make([]string, 0)
+	for _, dir := range dirs {
+		if wantDirs[dir] {
+			continue
+		}
+		wantDirs[dir] = true
+		if entry := h.cache.get("dir:" + dir); entry != nil {
+			byDir[dir] = entry
+		} else {
+			patterns = append(patterns, dir)
+		}
+	}
+	for _, path := range paths {
+		if wantPaths[path] {
+			continue
+		}
+		wantPaths[path] = true
+		if entry := h.cache.get("path:" + path); entry != nil {
+			byPath[path] = entry
+		} else {
+			patterns = append(patterns, path)
+		}
+	}
+	if len(patterns) == 0 {
+		return byDir, byPath, nil
+	}
+	pkgs, err := packages.Load(h.packagesConfig(packages.NeedName|packages.NeedFiles), patterns...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, pkg := range pkgs {
+		if wantPaths[pkg.ID] {
+			if len(pkg.Errors) > 0 {
+				return nil, nil, pkg.Errors[0]
+			}
+			byPath[pkg.ID] = h.cache.put("path:"+pkg.ID, pkg)
+		}
+		if len(pkg.GoFiles) == 0 {
+			continue
+		}
+		if dir := filepath.Dir(pkg.GoFiles[0]); wantDirs[dir] {
+			byDir[dir] = h.cache.put("dir:"+dir, pkg)
+		}
+	}
+	return byDir, byPath, nil
+}
+
+// moduleRoot 向上查找go.mod所在的目录
+func moduleRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,148 @@
+package dep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileNames 按顺序在每一级目录中查找的配置文件名
+var ConfigFileNames = []string{"autodig.yaml", "autodig.yml", ".autodig.json"}
+
+// Config 项目配置文件autodig.yaml/.autodig.json的内容, 命令行参数会覆盖其中的值.
+// scans和output中的相对路径基于配置文件所在目录
+type Config struct {
+	Scans []string `yaml:"scans" json:"scans"`
+	// Excludes 原样传给Autodig.SetExcludes
+	Excludes []string `yaml:"excludes" json:"excludes"`
+	// Includes 需要扫描的生成文件
+	Includes []string `yaml:"includes" json:"includes"`
+	Output   string   `yaml:"output" json:"output"`
+	Tag      string   `yaml:"tag" json:"tag"`
+	// GOOS/GOARCH/BuildTags 选择文件时使用的build constraints, 为空时使用当前环境
+	GOOS      string   `yaml:"goos" json:"goos"`
+	GOARCH    string   `yaml:"goarch" json:"goarch"`
+	BuildTags []string `yaml:"build_tags" json:"build_tags"`
+	// Strict 为nil时由调用方决定默认值
+	Strict    *bool  `yaml:"strict" json:"strict"`
+	MaxErrors int    `yaml:"max_errors" json:"max_errors"`
+	Mode      string `yaml:"mode" json:"mode"`
+	// RuntimePackage 生成代码使用的运行时包, 默认github.com/cindyoshinee/autodig/dep
+	RuntimePackage string `yaml:"runtime_package" json:"runtime_package"`
+	Naming         Naming `yaml:"naming" json:"naming"`
+	// Fakes 生成interface的fake实现到autodig_fake.go
+	Fakes bool `yaml:"fakes" json:"fakes"`
+	// LineDirectives 生成//line, 调用栈指向@autodig所在的源码
+	LineDirectives bool `yaml:"line_directives" json:"line_directives"`
+	// CacheDir 加载包的缓存目录, 为空时不使用缓存
+	CacheDir string `yaml:"cache_dir" json:"cache_dir"`
+
+	// Path 配置文件路径, 没有配置文件时为空
+	Path string `yaml:"-" json:"-"`
+	// GoGenerate 通过//go:generate调用, 跳过有自己指令的子目录
+	GoGenerate bool `yaml:"-" json:"-"`
+}
+
+// FindConfig 从dir开始逐级向上查找配置文件, 没有找到时返回空字符串
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range ConfigFileNames {
+			path := filepath.Join(dir, name)
+			info, err := os.Stat(path)
+			if err == nil && !info.IsDir() {
+				return path, nil
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig 读取配置文件, .json使用json格式, 其他使用yaml格式. 未知的字段会报错
+func LoadConfig(path string) (*Config, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config err: %v", err)
+	}
+	config := &Config{}
+	if filepath.Ext(path) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	} else {
+		err = yaml.UnmarshalStrict(content, config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s err: %v", path, err)
+	}
+	config.Path = path
+	dir := filepath.Dir(path)
+	for i, scan := range config.Scans {
+		config.Scans[i] = resolvePath(dir, scan)
+	}
+	if config.Output != "" {
+		config.Output = resolvePath(dir, config.Output)
+	}
+	if config.CacheDir != "" {
+		config.CacheDir = resolvePath(dir, config.CacheDir)
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("config %s err: %v", path, err)
+	}
+	return config, nil
+}
+
+// Validate 检查mode和命名模板
+func (c *Config) Validate() error {
+	if c.Mode != "" && c.Mode != OutputModeSingle && c.Mode != OutputModePackage {
+		return fmt.Errorf("unknown mode %q, should be %s or %s", c.Mode, OutputModeSingle, OutputModePackage)
+	}
+	return c.Naming.Validate()
+}
+
+// NewAutodig 根据配置创建Autodig
+func (c *Config) NewAutodig() *Autodig {
+	autodig := NewAutodig(c.Scans, c.Output, c.Tag).
+		SetMaxErrors(c.MaxErrors).
+		SetMode(c.Mode).
+		SetExcludes(c.Excludes).
+		SetIncludes(c.Includes).
+		SetRuntimePackage(c.RuntimePackage).
+		SetNaming(c.Naming).
+		SetFakes(c.Fakes).
+		SetLineDirectives(c.LineDirectives).
+		SetCacheDir(c.CacheDir).
+		SetGoGenerate(c.GoGenerate).
+		SetBuildEnv(BuildEnv{GOOS: c.GOOS, GOARCH: c.GOARCH, Tags: c.BuildTags})
+	if c.Strict != nil {
+		autodig.SetStrict(*c.Strict)
+	}
+	return autodig
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
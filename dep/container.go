@@ -1,13 +1,53 @@
 package dep
 
-import "go.uber.org/dig"
+import (
+	"sync"
+
+	"go.uber.org/dig"
+)
 
 var Container = dig.New()
 
+var (
+	overrideMu sync.RWMutex
+	overridden = make(map[Source]bool)
+)
+
+// Override 之后Provide时跳过sources对应的provider. 生成的autodig_test.go在包变量初始化阶段调用,
+// 早于所有init, 用测试中提供相同类型的provider替换生产代码中的provider
+func Override(sources ...Source) bool {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	for _, source := range sources {
+		overridden[source] = true
+	}
+	return true
+}
+
+func isOverridden(source Source) bool {
+	overrideMu.RLock()
+	defer overrideMu.RUnlock()
+	return overridden[source]
+}
+
 // Provide help for provider
 func Provide(cstors []interface{}, opts ...dig.ProvideOption) error {
+	return ProvideTo(Container, cstors, opts...)
+}
+
+// ProvideTo provide to the given container, used by the generated Register funcs
+func ProvideTo(container *dig.Container, cstors []interface{}, opts ...dig.ProvideOption) error {
 	for _, cstor := range cstors {
-		if err := Container.Provide(cstor, opts...); err != nil {
+		if sourced, ok := cstor.(*sourcedConstructor); ok {
+			if isOverridden(sourced.source) {
+				continue
+			}
+			if err := container.Provide(sourced.constructor, opts...); err != nil {
+				return &ProvideError{Source: sourced.source, Err: err}
+			}
+			continue
+		}
+		if err := container.Provide(cstor, opts...); err != nil {
 			return err
 		}
 	}
@@ -20,3 +60,12 @@ func MustProvide(cstors []interface{}, opts ...dig.ProvideOption) {
 		panic(err)
 	}
 }
+
+// MustRegister calls the generated Register funcs with Container, used by package output mode
+func MustRegister(registers ...func(container *dig.Container) error) {
+	for _, register := range registers {
+		if err := register(Container); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package dep
+
+import (
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io"
+	"sort"
+	"sync"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrTooManyErrors is returned when the number of errors reaches the max-errors cap
+var ErrTooManyErrors = errors.New("too many errors")
+
+type Diagnostic struct {
+	Pos      token.Position
+	Severity Severity
+	Msg      string
+}
+
+func (d *Diagnostic) String() string {
+	if d.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Msg)
+	}
+	return fmt.Sprintf("%s: %s", d.Severity, d.Msg)
+}
+
+// Diagnostics 收集生成过程中的所有错误和警告，出错后继续处理剩余的文件
+type Diagnostics struct {
+	mu        sync.Mutex
+	list      []*Diagnostic
+	errors    int
+	maxErrors int
+}
+
+// NewDiagnostics maxErrors <= 0 means no limit
+func NewDiagnostics(maxErrors int) *Diagnostics {
+	return &Diagnostics{maxErrors: maxErrors}
+}
+
+func (d *Diagnostics) Errorf(pos token.Position, format string, args ...interface{}) {
+	d.add(pos, SeverityError, fmt.Sprintf(format, args...))
+}
+
+func (d *Diagnostics) Warnf(pos token.Position, format string, args ...interface{}) {
+	d.add(pos, SeverityWarning, fmt.Sprintf(format, args...))
+}
+
+// AddError 记录一个error, 如果是posError/scanner.ErrorList则使用其中的位置信息
+func (d *Diagnostics) AddError(fset *token.FileSet, pos token.Pos, err error) {
+	var errList scanner.ErrorList
+	if errors.As(err, &errList) {
+		for _, each := range errList {
+			d.add(each.Pos, SeverityError, each.Msg)
+		}
+		return
+	}
+	var pErr *posError
+	if errors.As(err, &pErr) && pErr.pos.IsValid() {
+		pos = pErr.pos
+	}
+	var position token.Position
+	if fset != nil && pos.IsValid() {
+		position = fset.Position(pos)
+	}
+	d.add(position, SeverityError, err.Error())
+}
+
+func (d *Diagnostics) add(pos token.Position, severity Severity, msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.maxErrors > 0 && d.errors >= d.maxErrors {
+		return
+	}
+	d.list = append(d.list, &Diagnostic{Pos: pos, Severity: severity, Msg: msg})
+	if severity == SeverityError {
+		d.errors++
+	}
+}
+
+// merge 按other中记录的顺序加入d, 用于合并并行处理的结果
+func (d *Diagnostics) merge(other *Diagnostics) {
+	other.mu.Lock()
+	list := append([]*Diagnostic{}, other.list...)
+	other.mu.Unlock()
+	for _, each := range list {
+		d.add(each.Pos, each.Severity, each.Msg)
+	}
+}
+
+// Full 已达到max-errors上限，调用方应停止处理
+func (d *Diagnostics) Full() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.maxErrors > 0 && d.errors >= d.maxErrors
+}
+
+func (d *Diagnostics) HasErrors() bool {
+	return d.ErrorCount() > 0
+}
+
+func (d *Diagnostics) ErrorCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.errors
+}
+
+func (d *Diagnostics) WarningCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.list) - d.errors
+}
+
+// List returns diagnostics sorted by position
+func (d *Diagnostics) List() []*Diagnostic {
+	d.mu.Lock()
+	ret := make([]*Diagnostic, len(d.list))
+	copy(ret, d.list)
+	d.mu.Unlock()
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i].Pos, ret[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return ret
+}
+
+// Err returns nil if there is no error
+func (d *Diagnostics) Err() error {
+	if d.Full() {
+		return fmt.Errorf("%w: stopped after %d errors", ErrTooManyErrors, d.ErrorCount())
+	}
+	if n := d.ErrorCount(); n > 0 {
+		return fmt.Errorf("%d errors, %d warnings", n, d.WarningCount())
+	}
+	return nil
+}
+
+func (d *Diagnostics) Print(w io.Writer) {
+	for _, each := range d.List() {
+		fmt.Fprintln(w, each.String())
+	}
+	if d.Full() {
+		fmt.Fprintf(w, "too many errors (max-errors=%d)\n", d.maxErrors)
+	}
+	if errCount, warnCount := d.ErrorCount(), d.WarningCount(); errCount+warnCount > 0 {
+		fmt.Fprintf(w, "%d errors, %d warnings\n", errCount, warnCount)
+	}
+}
+
+// posError 带位置信息的错误，由declHandler返回，最终记录到Diagnostics
+type posError struct {
+	pos token.Pos
+	msg string
+}
+
+func newPosError(pos token.Pos, format string, args ...interface{}) error {
+	return &posError{pos: pos, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *posError) Error() string {
+	return e.msg
+}
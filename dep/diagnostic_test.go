@@ -0,0 +1,153 @@
+package dep
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiagnosticsPrint(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("b.go", -1, 100)
+	file.SetLines([]int{0, 10, 20, 30})
+
+	d := NewDiagnostics(0)
+	d.Warnf(token.Position{Filename: "b.go", Line: 3, Column: 1}, "unused %s", "x")
+	d.Errorf(token.Position{Filename: "a.go", Line: 9, Column: 2}, "bad field")
+	d.AddError(fset, file.Pos(0), newPosError(file.Pos(12), "from posError"))
+	d.AddError(nil, token.NoPos, scanner.ErrorList{
+		{Pos: token.Position{Filename: "a.go", Line: 2, Column: 5}, Msg: "expected ';'"},
+		{Pos: token.Position{Filename: "a.go", Line: 2, Column: 1}, Msg: "expected 'IDENT'"},
+	})
+	d.AddError(nil, token.NoPos, errors.New("no position"))
+
+	buffer := &bytes.Buffer{}
+	d.Print(buffer)
+	want := `error: no position
+a.go:2:1: error: expected 'IDENT'
+a.go:2:5: error: expected ';'
+a.go:9:2: error: bad field
+b.go:2:3: error: from posError
+b.go:3:1: warning: unused x
+5 errors, 1 warnings
+`
+	if buffer.String() != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", buffer.String(), want)
+	}
+	if err := d.Err(); err == nil || err.Error() != "5 errors, 1 warnings" {
+		t.Errorf("Err() = %v, want 5 errors, 1 warnings", err)
+	}
+	if NewDiagnostics(0).Err() != nil {
+		t.Errorf("Err() of empty diagnostics should be nil")
+	}
+}
+
+func TestDiagnosticsMaxErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxErrors int
+		// add 依次记录的diagnostic, true为error
+		add          []bool
+		wantErrors   int
+		wantWarnings int
+		wantFull     bool
+	}{
+		{name: "no limit", maxErrors: 0, add: []bool{true, false, true, true}, wantErrors: 3, wantWarnings: 1},
+		{name: "below limit", maxErrors: 3, add: []bool{true, false, true}, wantErrors: 2, wantWarnings: 1},
+		{name: "stops at limit", maxErrors: 2, add: []bool{true, false, true, true, false}, wantErrors: 2, wantWarnings: 1, wantFull: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDiagnostics(tt.maxErrors)
+			for i, isErr := range tt.add {
+				pos := token.Position{Filename: "a.go", Line: i + 1, Column: 1}
+				if isErr {
+					d.Errorf(pos, "error %d", i)
+				} else {
+					d.Warnf(pos, "warning %d", i)
+				}
+			}
+			if d.ErrorCount() != tt.wantErrors || d.WarningCount() != tt.wantWarnings {
+				t.Errorf("got %d errors, %d warnings, want %d, %d", d.ErrorCount(), d.WarningCount(), tt.wantErrors, tt.wantWarnings)
+			}
+			if d.Full() != tt.wantFull {
+				t.Errorf("Full() = %v, want %v", d.Full(), tt.wantFull)
+			}
+			if got := errors.Is(d.Err(), ErrTooManyErrors); got != tt.wantFull {
+				t.Errorf("errors.Is(Err(), ErrTooManyErrors) = %v, want %v", got, tt.wantFull)
+			}
+			buffer := &bytes.Buffer{}
+			d.Print(buffer)
+			if got := bytes.Contains(buffer.Bytes(), []byte("too many errors (max-errors=2)")); got != tt.wantFull {
+				t.Errorf("Print() =\n%s\nwant too many errors line: %v", buffer.String(), tt.wantFull)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsMerge(t *testing.T) {
+	first := NewDiagnostics(0)
+	first.Errorf(token.Position{Filename: "b.go", Line: 1}, "b1")
+	first.Warnf(token.Position{Filename: "b.go", Line: 2}, "b2")
+	second := NewDiagnostics(0)
+	second.Errorf(token.Position{Filename: "a.go", Line: 1}, "a1")
+	second.Errorf(token.Position{Filename: "a.go", Line: 2}, "a2")
+
+	// 合并时受d的max-errors限制, 按other中记录的顺序加入
+	d := NewDiagnostics(2)
+	d.merge(first)
+	d.merge(second)
+	got := make([]string, 0)
+	for _, each := range d.List() {
+		got = append(got, each.Msg)
+	}
+	if want := []string{"a1", "b1", "b2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %v, want %v", got, want)
+	}
+	if !d.Full() {
+		t.Errorf("Full() = false after merging 2 errors with max-errors=2")
+	}
+	// other不会被修改
+	if second.ErrorCount() != 2 {
+		t.Errorf("second.ErrorCount() = %d, want 2", second.ErrorCount())
+	}
+}
+
+func TestGenerateCollectsAllErrors(t *testing.T) {
+	badField := func(pkg string) string {
+		return "package " + pkg + "\n\ntype Item struct{}\n\n// @autodig\ntype Service struct {\n\tItem *Item `autodig:\"ingroup:items\"`\n}\n"
+	}
+	root := newTestModule(t, map[string]string{
+		"app/a/a.go":             badField("a"),
+		"app/b/b.go":             badField("b"),
+		"app/c/c.go":             "package c\n\n// @autodig\nfunc New() int {\n",
+		"app/entrypoint/main.go": "package entrypoint\n",
+	})
+	tests := []struct {
+		maxErrors  int
+		wantErrors int
+		wantFull   bool
+	}{
+		{maxErrors: 0, wantErrors: 3},
+		{maxErrors: 2, wantErrors: 2, wantFull: true},
+	}
+	for _, tt := range tests {
+		a := NewAutodig([]string{filepath.Join(root, "app")}, filepath.Join(root, "app", "entrypoint", "autodig.go"), "").
+			SetMaxErrors(tt.maxErrors)
+		_, _, err := a.Generate(context.Background())
+		if err == nil {
+			t.Fatalf("max-errors=%d: Generate() err = nil", tt.maxErrors)
+		}
+		if n := a.Diagnostics().ErrorCount(); n != tt.wantErrors {
+			t.Errorf("max-errors=%d: got %d errors, want %d: %v", tt.maxErrors, n, tt.wantErrors, a.Diagnostics().List())
+		}
+		if got := errors.Is(a.Diagnostics().Err(), ErrTooManyErrors); got != tt.wantFull {
+			t.Errorf("max-errors=%d: stopped early = %v, want %v", tt.maxErrors, got, tt.wantFull)
+		}
+	}
+}
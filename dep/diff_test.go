@@ -0,0 +1,82 @@
+package dep
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func seqLines(n int, replace map[int]string) []byte {
+	lines := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		line, ok := replace[i]
+		if !ok {
+			line = strconv.Itoa(i)
+		}
+		lines = append(lines, line)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []byte
+		want string
+	}{
+		{
+			name: "identical",
+			a:    []byte("a\nb\n"),
+			b:    []byte("a\nb\n"),
+			want: "",
+		},
+		{
+			name: "change in the middle",
+			a:    []byte("a\nb\nc\n"),
+			b:    []byte("a\nx\nc\n"),
+			want: "@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name: "new file",
+			a:    nil,
+			b:    []byte("a\nb\n"),
+			want: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "deleted file",
+			a:    []byte("a\nb\n"),
+			b:    nil,
+			want: "@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "delete and append",
+			a:    []byte("a\nb\nc\nd\n"),
+			b:    []byte("a\nc\nd\ne\n"),
+			want: "@@ -1,4 +1,4 @@\n a\n-b\n c\n d\n+e\n",
+		},
+		{
+			name: "distant changes use separate hunks",
+			a:    seqLines(20, nil),
+			b:    seqLines(20, map[int]string{2: "two", 18: "eighteen"}),
+			want: "@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+				"@@ -15,6 +15,6 @@\n 15\n 16\n 17\n-18\n+eighteen\n 19\n 20\n",
+		},
+		{
+			name: "close changes share a hunk",
+			a:    seqLines(20, nil),
+			b:    seqLines(20, map[int]string{5: "five", 11: "eleven"}),
+			want: "@@ -2,13 +2,13 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n 9\n 10\n-11\n+eleven\n 12\n 13\n 14\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want != "" {
+				want = "--- old\n+++ new\n" + want
+			}
+			if got := UnifiedDiff("old", "new", tt.a, tt.b); got != want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
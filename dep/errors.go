@@ -0,0 +1,64 @@
+package dep
+
+import "fmt"
+
+// Source 生成代码中记录的provider源码信息
+type Source struct {
+	// Symbol 源码中的struct/func, 如demo.Service
+	Symbol string
+	// Position 相对module根目录的位置, 如demo/sourcecode.go:34
+	Position string
+	// Annotation 源码中的@autodig注释
+	Annotation string
+}
+
+func (s Source) String() string {
+	return fmt.Sprintf("%s (%s)", s.Symbol, s.Position)
+}
+
+// ProvideError 注册provider到dig失败
+type ProvideError struct {
+	Source Source
+	Err    error
+}
+
+func (e *ProvideError) Error() string {
+	return fmt.Sprintf("%s provide failed: %v", e.Source, e.Err)
+}
+
+func (e *ProvideError) Unwrap() error {
+	return e.Err
+}
+
+// InitError 生成的struct构造函数中调用Init()失败.
+// dig返回的错误不支持Unwrap, 需要先用dig.RootCause取出InitError再使用errors.As
+type InitError struct {
+	Source Source
+	Err    error
+}
+
+func (e *InitError) Error() string {
+	return fmt.Sprintf("%s Init failed: %v", e.Source, e.Err)
+}
+
+func (e *InitError) Unwrap() error {
+	return e.Err
+}
+
+// WrapInitError err为nil时返回nil
+func WrapInitError(source Source, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &InitError{Source: source, Err: err}
+}
+
+type sourcedConstructor struct {
+	constructor interface{}
+	source      Source
+}
+
+// WithSource 给构造函数附加源码信息, Provide失败时返回带有源码信息的ProvideError
+func WithSource(constructor interface{}, source Source) interface{} {
+	return &sourcedConstructor{constructor: constructor, source: source}
+}
@@ -0,0 +1,71 @@
+package dep
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/dig"
+)
+
+type errorsTestClient struct{}
+
+type errorsTestService struct{}
+
+func TestProvideError(t *testing.T) {
+	source := Source{Symbol: "a.NewClient", Position: "a/a.go:12", Annotation: "@autodig"}
+	newClient := func() *errorsTestClient { return &errorsTestClient{} }
+	container := dig.New()
+	// 第二次提供同一个类型时dig报错
+	err := ProvideTo(container, []interface{}{WithSource(newClient, Source{Symbol: "a.First"}), WithSource(newClient, source)})
+	var provideErr *ProvideError
+	if !errors.As(err, &provideErr) {
+		t.Fatalf("ProvideTo() err = %v, want a ProvideError", err)
+	}
+	if provideErr.Source != source {
+		t.Errorf("ProvideError.Source = %+v, want %+v", provideErr.Source, source)
+	}
+	if !strings.HasPrefix(err.Error(), "a.NewClient (a/a.go:12) provide failed: ") {
+		t.Errorf("ProvideTo() err = %q, want the source as prefix", err)
+	}
+	if errors.Unwrap(err) != provideErr.Err || provideErr.Err == nil {
+		t.Errorf("Unwrap() = %v, want the dig error", errors.Unwrap(err))
+	}
+
+	// 没有源码信息的构造函数返回dig的原始错误
+	err = ProvideTo(container, []interface{}{newClient})
+	if err == nil || errors.As(err, &provideErr) {
+		t.Errorf("ProvideTo() err = %v, want a plain dig error", err)
+	}
+}
+
+func TestInitError(t *testing.T) {
+	if err := WrapInitError(Source{Symbol: "a.Service"}, nil); err != nil {
+		t.Errorf("WrapInitError(nil) = %v, want nil", err)
+	}
+
+	source := Source{Symbol: "a.Service", Position: "a/a.go:20", Annotation: "@autodig"}
+	initErr := errors.New("connect refused")
+	container := dig.New()
+	// 与生成的struct构造函数相同, Init()的错误用WrapInitError包装后返回
+	newService := func() (*errorsTestService, error) {
+		return nil, WrapInitError(source, initErr)
+	}
+	if err := ProvideTo(container, []interface{}{WithSource(newService, source)}); err != nil {
+		t.Fatalf("ProvideTo() err: %v", err)
+	}
+	err := container.Invoke(func(*errorsTestService) {})
+	if err == nil {
+		t.Fatalf("Invoke() err = nil, want the Init error")
+	}
+	var got *InitError
+	if !errors.As(dig.RootCause(err), &got) {
+		t.Fatalf("RootCause(%v) is not an InitError", err)
+	}
+	if got.Source != source || !errors.Is(got, initErr) {
+		t.Errorf("InitError = %+v, want source %+v wrapping %v", got, source, initErr)
+	}
+	if want := "a.Service (a/a.go:20) Init failed: connect refused"; got.Error() != want {
+		t.Errorf("InitError.Error() = %q, want %q", got.Error(), want)
+	}
+}
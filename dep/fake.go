@@ -0,0 +1,340 @@
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	// FakeOutputFileName fake实现生成到输出目录下的这个文件中
+	FakeOutputFileName = "autodig_fake.go"
+	// FakeTag -tag mock时注册fake实现, 替换生产代码中提供相同interface的provider
+	FakeTag = "mock"
+)
+
+// fakeIface 需要生成fake的interface
+type fakeIface struct {
+	named *types.Named
+	iface *types.Interface
+	// pos 第一次使用这个interface的位置
+	pos token.Position
+}
+
+// generateFakeFile 为DigReturn和被注入的interface生成fake实现: 每个方法对应一个XxxFunc字段, 并通过dep.FakeCalls记录调用参数.
+// -tag mock时fake会被注册到容器, 生产代码中提供相同interface(没有name和group)的provider通过dep.Override替换
+func (a *Autodig) generateFakeFile(files []string) (*genFile, error) {
+	outputFile := filepath.Join(filepath.Dir(a.outputDir), FakeOutputFileName)
+	outputPath, outputPkgName, err := (&importHandler{buildEnv: a.buildEnv, cache: a.cache, dir: moduleRoot(filepath.Dir(a.outputDir))}).getOutputImportPath(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("getOutputImportPath err: %v ", err)
+	}
+	checker := a.newProviderTypeChecker()
+	ifaces, overrides := a.collectFakeIfaces(checker, outputPath)
+	if len(ifaces) == 0 {
+		return nil, nil
+	}
+	inputHash := a.hashInputs(files, outputFile)
+	writer := newFakeWriter(outputPath, a.runtimePath)
+	for _, each := range ifaces {
+		writer.writeFake(each)
+	}
+	if a.cmdTag == FakeTag {
+		writer.writeRegister(ifaces, overrides)
+	}
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "%s\n// autodig version: %s\n// autodig inputs: %s\n\npackage %s\n\n", autodigHeaderText, Version, inputHash, outputPkgName)
+	writer.writeImports(buffer)
+	buffer.Write(writer.body.Bytes())
+	content, err := format.Source(buffer.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format %s err: %v", outputFile, err)
+	}
+	return &genFile{path: outputFile, content: content}, nil
+}
+
+// newProviderTypeChecker 一次加载所有provider所在的包并做类型检查
+func (a *Autodig) newProviderTypeChecker() *implChecker {
+	checker := newImplCheckerWithFiles(nil, a.buildEnv, moduleRoot(filepath.Dir(a.outputDir)))
+	pkgPaths := make([]string, 0, len(a.providers))
+	for _, provider := range a.providers {
+		pkgPaths = append(pkgPaths, provider.pkgPath)
+	}
+	checker.preload(pkgPaths)
+	return checker
+}
+
+// collectFakeIfaces 返回需要生成fake的interface, 以及-tag mock时需要被替换的provider
+func (a *Autodig) collectFakeIfaces(checker *implChecker, outputPath string) ([]*fakeIface, []*Provider) {
+	found := make(map[string]*fakeIface)
+	add := func(typ types.Type, pos token.Position) *fakeIface {
+		named, ok := typ.(*types.Named)
+		if !ok || named.Obj().Pkg() == nil {
+			return nil
+		}
+		iface, ok := named.Underlying().(*types.Interface)
+		if !ok {
+			return nil
+		}
+		key := types.TypeString(named, nil)
+		if exist, ok := found[key]; ok {
+			return exist
+		}
+		if reason := unfakeableReason(named, iface, outputPath); reason != "" {
+			a.diags.Warnf(pos, "cannot generate fake for %s: %s", key, reason)
+			found[key] = nil
+			return nil
+		}
+		found[key] = &fakeIface{named: named, iface: iface, pos: pos}
+		return found[key]
+	}
+	overrides := make([]*Provider, 0)
+	for _, provider := range a.providers {
+		pkg, err := checker.load(provider.pkgPath)
+		if err != nil {
+			a.diags.Warnf(provider.Pos, "cannot generate fakes for %s: %v", provider.Symbol, err)
+			continue
+		}
+		provided, consumed := providerTypes(pkg.Scope().Lookup(provider.ident))
+		for _, typ := range consumed {
+			add(typ, provider.Pos)
+		}
+		replaced := false
+		for _, typ := range provided {
+			if add(typ, provider.Pos) != nil {
+				replaced = true
+			}
+		}
+		// 所有提供的interface都生成fake, 但name和group的provider不会被fake替换
+		if replaced && provider.Name == "" && provider.Group == "" {
+			overrides = append(overrides, provider)
+		}
+	}
+	ifaces := make([]*fakeIface, 0, len(found))
+	for _, each := range found {
+		if each != nil {
+			ifaces = append(ifaces, each)
+		}
+	}
+	sort.Slice(ifaces, func(i, j int) bool {
+		return types.TypeString(ifaces[i].named, nil) < types.TypeString(ifaces[j].named, nil)
+	})
+	return ifaces, overrides
+}
+
+// providerTypes struct: DigReturn或*Struct为提供的类型, 没有name和group的注入字段为依赖;
+// func: 除error外的返回值为提供的类型, 参数为依赖
+func providerTypes(obj types.Object) (provided []types.Type, consumed []types.Type) {
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		structType, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok {
+			return nil, nil
+		}
+		for i := 0; i < structType.NumFields(); i++ {
+			field := structType.Field(i)
+			if field.Name() == ReturnFieldName {
+				provided = append(provided, field.Type())
+				continue
+			}
+			if !field.Exported() {
+				continue
+			}
+			if _, ok := reflect.StructTag(structType.Tag(i)).Lookup("autodig"); ok {
+				continue
+			}
+			consumed = append(consumed, field.Type())
+		}
+	case *types.Func:
+		signature := obj.Type().(*types.Signature)
+		for i := 0; i < signature.Params().Len(); i++ {
+			consumed = append(consumed, signature.Params().At(i).Type())
+		}
+		for i := 0; i < signature.Results().Len(); i++ {
+			provided = append(provided, signature.Results().At(i).Type())
+		}
+	}
+	return provided, consumed
+}
+
+func unfakeableReason(named *types.Named, iface *types.Interface, outputPath string) string {
+	samePkg := named.Obj().Pkg().Path() == outputPath
+	if !samePkg && !named.Obj().Exported() {
+		return "the interface is not exported"
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		if !samePkg && !iface.Method(i).Exported() {
+			return fmt.Sprintf("method %s is not exported", iface.Method(i).Name())
+		}
+	}
+	return ""
+}
+
+// fakeWriter 以源码文本的形式输出fake, import别名在输出时统一分配
+type fakeWriter struct {
+	outputPath  string
+	runtimePath string
+	body        *bytes.Buffer
+	imports     map[string]string
+	usedNames   map[string]bool
+}
+
+func newFakeWriter(outputPath string, runtimePath string) *fakeWriter {
+	if runtimePath == "" {
+		runtimePath = depImportPath
+	}
+	return &fakeWriter{
+		outputPath:  outputPath,
+		runtimePath: runtimePath,
+		body:        &bytes.Buffer{},
+		imports:     make(map[string]string),
+		usedNames:   make(map[string]bool),
+	}
+}
+
+func (w *fakeWriter) importName(path, name string) string {
+	if alias, ok := w.imports[path]; ok {
+		return alias
+	}
+	alias := name
+	for w.usedNames[alias] {
+		alias += "_"
+	}
+	w.usedNames[alias] = true
+	w.imports[path] = alias
+	return alias
+}
+
+func (w *fakeWriter) qualifier(pkg *types.Package) string {
+	if pkg.Path() == w.outputPath {
+		return ""
+	}
+	return w.importName(pkg.Path(), pkg.Name())
+}
+
+func (w *fakeWriter) typeString(typ types.Type) string {
+	return types.TypeString(typ, w.qualifier)
+}
+
+func (w *fakeWriter) runtime() string {
+	return w.importName(w.runtimePath, "dep")
+}
+
+// fakeName 如FakerepoUserRepo, 与struct构造函数的默认命名方式相同
+func (w *fakeWriter) fakeName(named *types.Named) string {
+	return fmt.Sprintf("Fake%s%s", named.Obj().Pkg().Name(), named.Obj().Name())
+}
+
+func (w *fakeWriter) writeFake(fake *fakeIface) {
+	name := w.fakeName(fake.named)
+	ifaceName := w.typeString(fake.named)
+	fmt.Fprintf(w.body, "// %s %s的fake实现, XxxFunc为nil时返回零值\n", name, ifaceName)
+	fmt.Fprintf(w.body, "type %s struct {\n", name)
+	fmt.Fprintf(w.body, "\t%s.FakeCalls\n", w.runtime())
+	for i := 0; i < fake.iface.NumMethods(); i++ {
+		method := fake.iface.Method(i)
+		fmt.Fprintf(w.body, "\t%sFunc func%s\n", method.Name(), w.signatureString(method.Type().(*types.Signature), false))
+	}
+	fmt.Fprintf(w.body, "}\n\n")
+	fmt.Fprintf(w.body, "var _ %s = (*%s)(nil)\n\n", ifaceName, name)
+	for i := 0; i < fake.iface.NumMethods(); i++ {
+		w.writeMethod(name, fake.iface.Method(i))
+	}
+}
+
+func (w *fakeWriter) writeMethod(fakeName string, method *types.Func) {
+	signature := method.Type().(*types.Signature)
+	fmt.Fprintf(w.body, "func (f *%s) %s%s {\n", fakeName, method.Name(), w.signatureString(signature, true))
+	args := make([]string, 0, signature.Params().Len())
+	for i := 0; i < signature.Params().Len(); i++ {
+		args = append(args, fmt.Sprintf("p%d", i))
+	}
+	recordArgs := append([]string{fmt.Sprintf("%q", method.Name())}, args...)
+	fmt.Fprintf(w.body, "\tf.FakeCalls.Record(%s)\n", strings.Join(recordArgs, ", "))
+	callArgs := strings.Join(args, ", ")
+	if signature.Variadic() {
+		callArgs += "..."
+	}
+	call := fmt.Sprintf("f.%sFunc(%s)", method.Name(), callArgs)
+	if signature.Results().Len() == 0 {
+		fmt.Fprintf(w.body, "\tif f.%sFunc != nil {\n\t\t%s\n\t}\n}\n\n", method.Name(), call)
+		return
+	}
+	fmt.Fprintf(w.body, "\tif f.%sFunc != nil {\n\t\treturn %s\n\t}\n", method.Name(), call)
+	results := make([]string, 0, signature.Results().Len())
+	for i := 0; i < signature.Results().Len(); i++ {
+		fmt.Fprintf(w.body, "\tvar r%d %s\n", i, w.typeString(signature.Results().At(i).Type()))
+		results = append(results, fmt.Sprintf("r%d", i))
+	}
+	fmt.Fprintf(w.body, "\treturn %s\n}\n\n", strings.Join(results, ", "))
+}
+
+// signatureString named为true时参数命名为p0, p1...
+func (w *fakeWriter) signatureString(signature *types.Signature, named bool) string {
+	params := make([]string, 0, signature.Params().Len())
+	for i := 0; i < signature.Params().Len(); i++ {
+		typ := signature.Params().At(i).Type()
+		typString := w.typeString(typ)
+		if signature.Variadic() && i == signature.Params().Len()-1 {
+			typString = "..." + w.typeString(typ.(*types.Slice).Elem())
+		}
+		if named {
+			typString = fmt.Sprintf("p%d %s", i, typString)
+		}
+		params = append(params, typString)
+	}
+	results := make([]string, 0, signature.Results().Len())
+	for i := 0; i < signature.Results().Len(); i++ {
+		results = append(results, w.typeString(signature.Results().At(i).Type()))
+	}
+	text := "(" + strings.Join(params, ", ") + ")"
+	switch len(results) {
+	case 0:
+	case 1:
+		text += " " + results[0]
+	default:
+		text += " (" + strings.Join(results, ", ") + ")"
+	}
+	return text
+}
+
+// writeRegister 注册fake, 同时提供*FakeXxx和interface, 测试中可以注入*FakeXxx设置XxxFunc
+func (w *fakeWriter) writeRegister(ifaces []*fakeIface, overrides []*Provider) {
+	runtime := w.runtime()
+	if len(overrides) > 0 {
+		fmt.Fprintf(w.body, "var _ = %s.%s(\n", runtime, depOverrideMethod)
+		for _, provider := range overrides {
+			fmt.Fprintf(w.body, "\t%s.Source{Symbol: %q, Position: %q, Annotation: %q},\n", runtime, provider.Symbol, provider.RelPos, provider.Annotation)
+		}
+		fmt.Fprintf(w.body, ")\n\n")
+	}
+	fmt.Fprintf(w.body, "func init() {\n\t%s.%s([]interface{}{\n", runtime, depProvideMethod)
+	for _, each := range ifaces {
+		name := w.fakeName(each.named)
+		fmt.Fprintf(w.body, "\t\tfunc() *%s { return &%s{} },\n", name, name)
+		fmt.Fprintf(w.body, "\t\tfunc(f *%s) %s { return f },\n", name, w.typeString(each.named))
+	}
+	fmt.Fprintf(w.body, "\t})\n}\n")
+}
+
+func (w *fakeWriter) writeImports(buffer *bytes.Buffer) {
+	if len(w.imports) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(w.imports))
+	for path := range w.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	buffer.WriteString("import (\n")
+	for _, path := range paths {
+		fmt.Fprintf(buffer, "\t%s %q\n", w.imports[path], path)
+	}
+	buffer.WriteString(")\n\n")
+}
@@ -0,0 +1,40 @@
+package dep
+
+import "sync"
+
+// FakeCalls 记录fake方法的调用参数, 嵌入在生成的fake中
+type FakeCalls struct {
+	mu    sync.Mutex
+	calls map[string][][]interface{}
+}
+
+// Record 记录一次method调用
+func (c *FakeCalls) Record(method string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string][][]interface{})
+	}
+	c.calls[method] = append(c.calls[method], args)
+}
+
+// Calls 返回method每次调用的参数
+func (c *FakeCalls) Calls(method string) [][]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]interface{}{}, c.calls[method]...)
+}
+
+// CallCount 返回method被调用的次数
+func (c *FakeCalls) CallCount(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.calls[method])
+}
+
+// ResetCalls 清空调用记录
+func (c *FakeCalls) ResetCalls() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+}
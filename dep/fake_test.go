@@ -0,0 +1,119 @@
+package dep
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+const fakeRepoSource = `package repo
+
+import "context"
+
+type User struct{}
+
+type Repo interface {
+	Get(ctx context.Context, id int64) (*User, error)
+	Find(names ...string) []*User
+	Log(format string, args ...interface{})
+	Close()
+	Pair() (a, b int)
+	Apply(fn func(int) error, m map[string][]byte) bool
+}
+`
+
+// checkFakeRepo 类型检查fakeRepoSource, 返回其中的Repo interface
+func checkFakeRepo(t *testing.T) *types.Interface {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "repo.go", fakeRepoSource, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check("example.com/repo", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg.Scope().Lookup("Repo").Type().Underlying().(*types.Interface)
+}
+
+func TestFakeSignatureString(t *testing.T) {
+	iface := checkFakeRepo(t)
+	tests := []struct {
+		method     string
+		outputPath string
+		want       string
+		wantNamed  string
+	}{
+		{"Get", "example.com/repo", "(context.Context, int64) (*User, error)", "(p0 context.Context, p1 int64) (*User, error)"},
+		{"Get", "example.com/other", "(context.Context, int64) (*repo.User, error)", "(p0 context.Context, p1 int64) (*repo.User, error)"},
+		{"Find", "example.com/repo", "(...string) []*User", "(p0 ...string) []*User"},
+		{"Log", "example.com/repo", "(string, ...interface{})", "(p0 string, p1 ...interface{})"},
+		{"Close", "example.com/repo", "()", "()"},
+		{"Pair", "example.com/repo", "() (int, int)", "() (int, int)"},
+		{"Apply", "example.com/repo", "(func(int) error, map[string][]byte) bool", "(p0 func(int) error, p1 map[string][]byte) bool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" in "+tt.outputPath, func(t *testing.T) {
+			var method *types.Func
+			for i := 0; i < iface.NumMethods(); i++ {
+				if iface.Method(i).Name() == tt.method {
+					method = iface.Method(i)
+				}
+			}
+			signature := method.Type().(*types.Signature)
+			w := newFakeWriter(tt.outputPath, "")
+			if got := w.signatureString(signature, false); got != tt.want {
+				t.Errorf("signatureString(false) = %q, want %q", got, tt.want)
+			}
+			if got := w.signatureString(signature, true); got != tt.wantNamed {
+				t.Errorf("signatureString(true) = %q, want %q", got, tt.wantNamed)
+			}
+		})
+	}
+}
+
+func TestFakeWriteMethod(t *testing.T) {
+	iface := checkFakeRepo(t)
+	tests := []struct {
+		method string
+		want   string
+	}{
+		{"Log", `func (f *FakerepoRepo) Log(p0 string, p1 ...interface{}) {
+	f.FakeCalls.Record("Log", p0, p1)
+	if f.LogFunc != nil {
+		f.LogFunc(p0, p1...)
+	}
+}
+
+`},
+		{"Pair", `func (f *FakerepoRepo) Pair() (int, int) {
+	f.FakeCalls.Record("Pair")
+	if f.PairFunc != nil {
+		return f.PairFunc()
+	}
+	var r0 int
+	var r1 int
+	return r0, r1
+}
+
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			for i := 0; i < iface.NumMethods(); i++ {
+				if iface.Method(i).Name() != tt.method {
+					continue
+				}
+				w := newFakeWriter("example.com/repo", "")
+				w.writeMethod("FakerepoRepo", iface.Method(i))
+				if got := w.body.String(); got != tt.want {
+					t.Errorf("writeMethod() =\n%s\nwant\n%s", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package dep
 
 import (
-	"fmt"
 	"go/ast"
 	"reflect"
 )
@@ -38,7 +37,7 @@ func (h *FieldHandler) changeImportExpr(expr ast.Expr) (ast.Expr, error) {
 		expr := expr.(*ast.SelectorExpr)
 		thisimport, ok := expr.X.(*ast.Ident)
 		if !ok {
-			return nil, fmt.Errorf("===========selector X not ident")
+			return nil, newPosError(expr.Pos(), "selector X not ident")
 		}
 		if h.fileCtx.importMapInfile[thisimport.Name] == h.importCtx.outputImportPath {
 			return expr.Sel, nil
@@ -70,7 +69,7 @@ func (h *FieldHandler) changeImportExpr(expr ast.Expr) (ast.Expr, error) {
 		}
 		arrayExpr.Elt = elt
 	default:
-		return nil, fmt.Errorf("===========field type invalid")
+		return nil, newPosError(expr.Pos(), "field type invalid: %s", reflect.TypeOf(expr).Elem().Name())
 	}
 	return expr, nil
 }
@@ -104,7 +103,7 @@ func (h *FieldHandler) getFieldExprName(expr ast.Expr) (string, error) {
 		expr := expr.(*ast.Ident)
 		typeName = expr.Name
 	default:
-		return "", fmt.Errorf("unknown noname field type: %s", reflect.TypeOf(expr).Elem().Name())
+		return "", newPosError(expr.Pos(), "unknown noname field type: %s", reflect.TypeOf(expr).Elem().Name())
 	}
 	return typeName, nil
 }
@@ -3,24 +3,30 @@ package dep
 import (
 	"fmt"
 	"go/ast"
-	"go/parser"
 	"go/token"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 const (
-	digImportPath         = "go.uber.org/dig"
-	digProvideGroupMethod = "Group"
-	digProvideNameMethod  = "Name"
-	depImportPath         = "github.com/cindyoshinee/autodig/dep"
-	depProvideMethod      = "MustProvide"
-	StarExpr              = "StarExpr"
-	Ident                 = "Ident"
-	SelectorExpr          = "SelectorExpr"
-	MapType               = "MapType"
-	ArrayType             = "ArrayType"
-	GroupNameDefault      = "default"
+	digImportPath          = "go.uber.org/dig"
+	digProvideGroupMethod  = "Group"
+	digProvideNameMethod   = "Name"
+	depImportPath          = "github.com/cindyoshinee/autodig/dep"
+	depProvideMethod       = "MustProvide"
+	depProvideToMethod     = "ProvideTo"
+	depWithSourceMethod    = "WithSource"
+	depWrapInitErrorMethod = "WrapInitError"
+	depSourceType          = "Source"
+	StarExpr               = "StarExpr"
+	Ident                  = "Ident"
+	SelectorExpr           = "SelectorExpr"
+	MapType                = "MapType"
+	ArrayType              = "ArrayType"
+	GroupNameDefault       = "default"
 )
 
 var (
@@ -28,13 +34,17 @@ var (
 )
 
 type globalNewFunc struct {
-	decl       *ast.FuncDecl
+	decl *ast.FuncDecl
+	// assertDecl 编译期断言DigReturn被实现, 如var _ Iface = (*Struct)(nil)
+	assertDecl ast.Decl
 	structName string
 	groupName  string
 	name       string
+	provider   *Provider
 }
 
 type fileCtx struct {
+	fset             *token.FileSet
 	file             string
 	pkg              string
 	importMapInfile  map[string]string
@@ -42,6 +52,23 @@ type fileCtx struct {
 	importGlobalPath string
 }
 
+func (c *fileCtx) newProvider(ident *ast.Ident, commentNode *ast.Comment, comment *comment) *Provider {
+	provider := &Provider{
+		Symbol:     fmt.Sprintf("%s.%s", c.pkg, ident.Name),
+		Name:       comment.name,
+		Tag:        comment.tag,
+		Annotation: strings.TrimSpace(strings.TrimPrefix(commentNode.Text, "//")),
+		Pos:        c.fset.Position(ident.Pos()),
+		pkgPath:    c.importGlobalPath,
+		ident:      ident.Name,
+	}
+	provider.RelPos = fmt.Sprintf("%s:%d", moduleRelPath(c.file), provider.Pos.Line)
+	if comment.outGroup != GroupNameDefault {
+		provider.Group = comment.outGroup
+	}
+	return provider
+}
+
 type fieldWithTag struct {
 	field *ast.Field
 	group string
@@ -60,83 +87,182 @@ type DeclHandler interface {
 
 type FileBuilder interface {
 	BuildDecls(files []string, importCtx *ImportCtx, tag string) ([]ast.Decl, error)
+	// Providers 返回BuildDecls过程中收集到的所有provider
+	Providers() []*Provider
 }
 
 type fileBuilder struct {
-	importCtx       *ImportCtx
+	importCtx     *ImportCtx
+	diags         *Diagnostics
+	opts          BuildOptions
+	implChecker   *implChecker
+	namer         *namer
+	providers     []*Provider
+	declProviders map[ast.Decl]*Provider
+}
+
+// declHandlers 每个文件使用自己的handler, 可以并行处理
+type declHandlers struct {
 	genDeclHandler  DeclHandler
 	funcDeclHandler DeclHandler
 }
 
+// fileResult 一个文件的处理结果, 所有文件处理完后按文件顺序合并
+type fileResult struct {
+	decls         []ast.Decl
+	digFuncs      map[string]*eachDigFuncs
+	providers     []*Provider
+	declProviders map[ast.Decl]*Provider
+	diags         *Diagnostics
+}
+
 type eachDigFuncs struct {
 	funcDecls []ast.Decl
 	group     string
 	name      string
 }
 
-func NewFileBuilder(importCtx *ImportCtx) FileBuilder {
-	return &fileBuilder{importCtx: importCtx}
+type BuildOptions struct {
+	// Strict 注释中无法识别的内容会作为error报告
+	Strict bool
+	// Register 生成func Register(c *dig.Container) error而不是init
+	Register bool
+	// Naming 生成函数的命名模板, 为空时使用默认模板
+	Naming Naming
+}
+
+func NewFileBuilder(importCtx *ImportCtx, diags *Diagnostics, opts BuildOptions) FileBuilder {
+	return &fileBuilder{importCtx: importCtx, diags: diags, opts: opts}
 }
 
-func (b *fileBuilder) GenDeclHandlers(fileCtx *fileCtx, cmdTag string) {
+func (b *fileBuilder) newDeclHandlers(fileCtx *fileCtx, cmdTag string, diags *Diagnostics) *declHandlers {
 	cmdTagCheckFunc := b.genTagCheckFunc(cmdTag)
 	fieldHandler := NewFieldHandler(fileCtx, b.importCtx)
-	b.funcDeclHandler = &funcDeclHandler{importCtx: b.importCtx, fieldHandler: fieldHandler, fileCtx: fileCtx, cmdTagCheckFunc: cmdTagCheckFunc}
-	b.genDeclHandler = &genDeclHandler{importCtx: b.importCtx, fieldHandler: fieldHandler, fileCtx: fileCtx, cmdTagCheckFunc: cmdTagCheckFunc}
+	checker := &annotationChecker{fset: fileCtx.fset, diags: diags, strict: b.opts.Strict}
+	return &declHandlers{
+		funcDeclHandler: &funcDeclHandler{importCtx: b.importCtx, fieldHandler: fieldHandler, fileCtx: fileCtx, cmdTagCheckFunc: cmdTagCheckFunc, checker: checker, namer: b.namer},
+		genDeclHandler:  &genDeclHandler{importCtx: b.importCtx, fieldHandler: fieldHandler, fileCtx: fileCtx, cmdTagCheckFunc: cmdTagCheckFunc, checker: checker, implChecker: b.implChecker, namer: b.namer},
+	}
+}
+
+func (h *declHandlers) get(decl ast.Decl) DeclHandler {
+	switch reflect.TypeOf(decl).Elem().Name() {
+	case "FuncDecl":
+		return h.funcDeclHandler
+	default:
+		return h.genDeclHandler
+	}
 }
 
 func (b *fileBuilder) BuildDecls(files []string, importCtx *ImportCtx, tag string) ([]ast.Decl, error) {
+	var err error
+	b.namer, err = newNamer(b.opts.Naming)
+	if err != nil {
+		return nil, err
+	}
 	b.importCtx = importCtx
+	if b.importCtx.sources == nil {
+		b.importCtx.sources = newSourceSet(b.importCtx.cache)
+	}
+	b.implChecker = newImplChecker(importCtx)
+	b.declProviders = make(map[ast.Decl]*Provider)
+	// 同一个包的文件在一个worker中按顺序处理, 不同的包并行处理
+	results := make([]*fileResult, len(files))
+	pkgFiles := groupFilesByDir(files)
+	parallel(len(pkgFiles), func(i int) {
+		for _, index := range pkgFiles[i] {
+			results[index] = b.handleEachFile(files[index], tag)
+		}
+	})
 	funcs := []ast.Decl{importCtx.globalImportDecl}
-	fset := token.NewFileSet()
 	allDigFuncs := make(map[string]*eachDigFuncs)
-	for _, file := range files {
-		eachFileFuncs, err := b.handleEachFile(file, fset, tag)
-		if err != nil {
-			return nil, fmt.Errorf("handleEachFile file: %s, err: %v ", file, err)
+	for _, result := range results {
+		if b.diags.Full() {
+			break
 		}
-		if eachFileFuncs == nil {
+		b.diags.merge(result.diags)
+		if result.digFuncs == nil {
 			continue
 		}
-		for _, each := range eachFileFuncs {
-			funcs = append(funcs, each.funcDecls...)
-		}
-		for key, eachFunc := range eachFileFuncs {
+		funcs = append(funcs, result.decls...)
+		for key, eachFunc := range result.digFuncs {
 			if _, ok := allDigFuncs[key]; ok {
 				allDigFuncs[key].funcDecls = append(allDigFuncs[key].funcDecls, eachFunc.funcDecls...)
 			} else {
 				allDigFuncs[key] = eachFunc
 			}
 		}
+		b.providers = append(b.providers, result.providers...)
+		for decl, provider := range result.declProviders {
+			b.declProviders[decl] = provider
+		}
+	}
+	if err := b.diags.Err(); err != nil {
+		return nil, err
 	}
 	funcs = append(funcs, b.buildInitFunc(allDigFuncs))
 	return funcs, nil
 }
 
-func (b *fileBuilder) handleEachFile(file string, fset *token.FileSet, tag string) (map[string]*eachDigFuncs, error) {
-	fileAST, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
-	if err != nil {
-		return nil, fmt.Errorf("parseFile file: %s, err: %v ", file, err)
+// groupFilesByDir 按目录(包)分组, 返回每组文件在files中的下标
+func groupFilesByDir(files []string) [][]int {
+	groups := make([][]int, 0)
+	dirIndex := make(map[string]int)
+	for i, file := range files {
+		dir := filepath.Dir(file)
+		if _, ok := dirIndex[dir]; !ok {
+			dirIndex[dir] = len(groups)
+			groups = append(groups, nil)
+		}
+		groups[dirIndex[dir]] = append(groups[dirIndex[dir]], i)
 	}
+	return groups
+}
+
+func (b *fileBuilder) Providers() []*Provider {
+	return b.providers
+}
+
+// handleEachFile 返回按源码顺序生成的decl, 以及按group/name分组的构造函数.
+// 出错的decl会记录到result.diags并跳过，继续处理文件中其余的decl
+func (b *fileBuilder) handleEachFile(file string, tag string) *fileResult {
+	fset := b.importCtx.sources.fset
+	result := &fileResult{declProviders: make(map[ast.Decl]*Provider), diags: NewDiagnostics(b.diags.maxErrors)}
+	parsed := b.importCtx.sources.get(file)
+	if parsed.err != nil {
+		result.diags.AddError(fset, token.NoPos, parsed.err)
+		return result
+	}
+	fileAST := parsed.ast
 	fileCtx := &fileCtx{
+		fset:             fset,
 		file:             file,
 		pkg:              fileAST.Name.Name,
 		importMapInfile:  getImportsMap(fileAST.Imports, b.importCtx),
 		importGlobalPath: b.importCtx.getGlobalImportPathByFile(file),
 		importGlobalName: b.importCtx.getGlobalImportNameByFile(file),
 	}
-	b.GenDeclHandlers(fileCtx, tag)
+	handlers := b.newDeclHandlers(fileCtx, tag, result.diags)
 	funcGroupMap := make(map[string]*eachDigFuncs)
 	funcStructMap := make(map[string]*ast.FuncDecl)
 	// 遍历文件内容，找到所有需要自动依赖注入的struct
 	for _, decl := range fileAST.Decls {
-		newGlobalFunc, err := b.getDeclHandler(decl).Handle(decl)
+		if result.diags.Full() {
+			break
+		}
+		// 生成时会修改decl, 源码的AST是共享的, 有@autodig的decl使用拷贝
+		if hasAutodigComment(declDoc(decl)) {
+			decl = cloneDecl(decl)
+		}
+		newGlobalFunc, err := handlers.get(decl).Handle(decl)
 		if err != nil {
-			return nil, fmt.Errorf("file handle decl err: %s, err: %v ", file, err)
+			result.diags.AddError(fset, decl.Pos(), err)
+			continue
 		}
 		if newGlobalFunc == nil {
 			continue
 		}
+		newGlobalFunc.decl.Doc = buildSourceComment(newGlobalFunc.provider)
 		mapName := fmt.Sprintf("%s:%s", newGlobalFunc.groupName, newGlobalFunc.name)
 		_, ok := funcGroupMap[mapName]
 		if ok {
@@ -148,18 +274,27 @@ func (b *fileBuilder) handleEachFile(file string, fset *token.FileSet, tag strin
 				funcDecls: []ast.Decl{newGlobalFunc.decl},
 			}
 		}
-		funcStructMap[newGlobalFunc.structName] = newGlobalFunc.decl
+		result.decls = append(result.decls, newGlobalFunc.decl)
+		if newGlobalFunc.assertDecl != nil {
+			result.decls = append(result.decls, newGlobalFunc.assertDecl)
+		}
+		if newGlobalFunc.structName != "" {
+			funcStructMap[newGlobalFunc.structName] = newGlobalFunc.decl
+		}
+		result.providers = append(result.providers, newGlobalFunc.provider)
+		result.declProviders[newGlobalFunc.decl] = newGlobalFunc.provider
 	}
 	if len(funcGroupMap) == 0 {
-		return nil, nil
+		return result
 	}
+	result.digFuncs = funcGroupMap
 	// 遍历文件内容，找到是否有Init方法
-	b.handleInit(fileAST, funcStructMap)
-	return funcGroupMap, nil
+	b.handleInit(fileAST, funcStructMap, result.declProviders)
+	return result
 }
 
 // nolint
-func (b *fileBuilder) handleInit(fileAST *ast.File, autoDigFuncs map[string]*ast.FuncDecl) {
+func (b *fileBuilder) handleInit(fileAST *ast.File, autoDigFuncs map[string]*ast.FuncDecl, declProviders map[ast.Decl]*Provider) {
 	for _, decl := range fileAST.Decls {
 		if reflect.TypeOf(decl).Elem().Name() != "FuncDecl" {
 			continue
@@ -185,13 +320,26 @@ func (b *fileBuilder) handleInit(fileAST *ast.File, autoDigFuncs map[string]*ast
 			structName = expr.Name
 		default:
 		}
-		originFunc := autoDigFuncs[structName]
+		originFunc, ok := autoDigFuncs[structName]
+		if !ok {
+			continue
+		}
+		// autoDigErr = dep.WrapInitError(dep.Source{...}, service.Init())
 		Init := &ast.AssignStmt{
 			Lhs: []ast.Expr{&ast.Ident{Name: "autoDigErr"}},
 			Rhs: []ast.Expr{&ast.CallExpr{
 				Fun: &ast.SelectorExpr{
-					X:   &ast.Ident{Name: strings.ToLower(structName)},
-					Sel: &ast.Ident{Name: "Init"},
+					X:   &ast.Ident{Name: b.importCtx.runtimeName()},
+					Sel: &ast.Ident{Name: depWrapInitErrorMethod},
+				},
+				Args: []ast.Expr{
+					b.buildSourceExpr(declProviders[originFunc]),
+					&ast.CallExpr{
+						Fun: &ast.SelectorExpr{
+							X:   &ast.Ident{Name: strings.ToLower(structName)},
+							Sel: &ast.Ident{Name: "Init"},
+						},
+					},
 				},
 			}},
 			Tok: token.ASSIGN,
@@ -199,6 +347,9 @@ func (b *fileBuilder) handleInit(fileAST *ast.File, autoDigFuncs map[string]*ast
 		returnStmt := originFunc.Body.List[len(originFunc.Body.List)-1]
 		originFunc.Body.List = append(originFunc.Body.List[:len(originFunc.Body.List)-1], Init)
 		originFunc.Body.List = append(originFunc.Body.List, returnStmt)
+		if provider := declProviders[originFunc]; provider != nil {
+			provider.Init = true
+		}
 	}
 }
 
@@ -244,6 +395,9 @@ func (b *fileBuilder) genTagCheckFunc(cmdTag string) func(codeTag string) bool {
 }
 
 func (b *fileBuilder) buildInitFunc(digFuncs map[string]*eachDigFuncs) ast.Decl {
+	if b.opts.Register {
+		return b.buildRegisterFunc(digFuncs)
+	}
 	initFunc := &ast.FuncDecl{
 		Name: &ast.Ident{
 			Name: "init",
@@ -253,14 +407,87 @@ func (b *fileBuilder) buildInitFunc(digFuncs map[string]*eachDigFuncs) ast.Decl
 			List: make([]ast.Stmt, 0),
 		},
 	}
-	for _, eachDigFunc := range digFuncs {
+	for _, args := range b.buildProvideArgs(digFuncs) {
+		initFunc.Body.List = append(initFunc.Body.List, &ast.ExprStmt{
+			X: &ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X:   &ast.Ident{Name: b.importCtx.runtimeName()},
+					Sel: &ast.Ident{Name: depProvideMethod},
+				},
+				Args: args,
+			},
+		})
+	}
+	return initFunc
+}
+
+// buildRegisterFunc package模式下生成:
+//
+//	func Register(c *dig.Container) error {
+//		if err := dep.ProvideTo(c, []interface{}{...}); err != nil {
+//			return err
+//		}
+//		return nil
+//	}
+func (b *fileBuilder) buildRegisterFunc(digFuncs map[string]*eachDigFuncs) ast.Decl {
+	digName := b.importCtx.getGlobalImportNameByPath(digImportPath)
+	registerFunc := &ast.FuncDecl{
+		Name: &ast.Ident{Name: registerFuncName},
+		Type: &ast.FuncType{
+			Params: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{{Name: "c"}},
+				Type:  &ast.StarExpr{X: &ast.SelectorExpr{X: &ast.Ident{Name: digName}, Sel: &ast.Ident{Name: "Container"}}},
+			}}},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: &ast.Ident{Name: "error"}}}},
+		},
+		Body: &ast.BlockStmt{List: make([]ast.Stmt, 0)},
+	}
+	for _, args := range b.buildProvideArgs(digFuncs) {
+		registerFunc.Body.List = append(registerFunc.Body.List, &ast.IfStmt{
+			Init: &ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.Ident{Name: "err"}},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{&ast.CallExpr{
+					Fun: &ast.SelectorExpr{
+						X:   &ast.Ident{Name: b.importCtx.runtimeName()},
+						Sel: &ast.Ident{Name: depProvideToMethod},
+					},
+					Args: append([]ast.Expr{&ast.Ident{Name: "c"}}, args...),
+				}},
+			},
+			Cond: &ast.BinaryExpr{X: &ast.Ident{Name: "err"}, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+			Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{&ast.Ident{Name: "err"}}}}},
+		})
+	}
+	registerFunc.Body.List = append(registerFunc.Body.List, &ast.ReturnStmt{Results: []ast.Expr{&ast.Ident{Name: "nil"}}})
+	return registerFunc
+}
+
+// buildProvideArgs 每个group/name生成一组Provide参数: []interface{}{...}, dig.Group(...), dig.Name(...)
+func (b *fileBuilder) buildProvideArgs(digFuncs map[string]*eachDigFuncs) [][]ast.Expr {
+	ret := make([][]ast.Expr, 0, len(digFuncs))
+	// map遍历顺序不固定, 按group:name排序保证每次生成的结果一致
+	keys := make([]string, 0, len(digFuncs))
+	for key := range digFuncs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		eachDigFunc := digFuncs[key]
 		funcList := make([]ast.Expr, 0)
 		for _, eachFunc := range eachDigFunc.funcDecls {
 			eachFuncExpr, ok := eachFunc.(*ast.FuncDecl)
 			if !ok {
 				continue
 			}
-			funcList = append(funcList, eachFuncExpr.Name)
+			// dep.WithSource(NewdemoService, dep.Source{...})
+			funcList = append(funcList, &ast.CallExpr{
+				Fun: &ast.SelectorExpr{
+					X:   &ast.Ident{Name: b.importCtx.runtimeName()},
+					Sel: &ast.Ident{Name: depWithSourceMethod},
+				},
+				Args: []ast.Expr{eachFuncExpr.Name, b.buildSourceExpr(b.declProviders[eachFuncExpr])},
+			})
 		}
 		args := []ast.Expr{
 			&ast.CompositeLit{
@@ -286,29 +513,45 @@ func (b *fileBuilder) buildInitFunc(digFuncs map[string]*eachDigFuncs) ast.Decl
 				Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("\"%s\"", eachDigFunc.name)}},
 			})
 		}
-		initFunc.Body.List = append(initFunc.Body.List, &ast.ExprStmt{
-			X: &ast.CallExpr{
-				Fun: &ast.SelectorExpr{
-					X:   &ast.Ident{Name: b.importCtx.getGlobalImportNameByPath(depImportPath)},
-					Sel: &ast.Ident{Name: depProvideMethod},
-				},
-				Args: args,
-			},
-		})
+		ret = append(ret, args)
 	}
-	return initFunc
+	return ret
 }
 
-func (b *fileBuilder) getDeclHandler(decl ast.Decl) DeclHandler {
-	switch reflect.TypeOf(decl).Elem().Name() {
-	case "FuncDecl":
-		return b.funcDeclHandler
-	default:
-		return b.genDeclHandler
+// buildSourceExpr dep.Source{Symbol: "demo.Service", Position: "demo/sourcecode.go:34", Annotation: "@autodig"}
+func (b *fileBuilder) buildSourceExpr(provider *Provider) ast.Expr {
+	return newSourceExpr(b.importCtx.runtimeName(), provider)
+}
+
+// buildSourceComment // source: demo/sourcecode.go:42 (@autodig outgroup:loggers)
+func buildSourceComment(provider *Provider) *ast.CommentGroup {
+	text := fmt.Sprintf("%s %s (%s)", sourceCommentPrefix, provider.RelPos, provider.Annotation)
+	return &ast.CommentGroup{List: []*ast.Comment{{Text: text}}}
+}
+
+// newSourceExpr dep.Source{Symbol: ..., Position: ..., Annotation: ...}
+func newSourceExpr(runtimeName string, provider *Provider) ast.Expr {
+	fields := [][2]string{{"Symbol", provider.Symbol}, {"Position", provider.RelPos}, {"Annotation", provider.Annotation}}
+	elts := make([]ast.Expr, 0, len(fields))
+	for _, field := range fields {
+		elts = append(elts, &ast.KeyValueExpr{
+			Key:   &ast.Ident{Name: field[0]},
+			Value: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(field[1])},
+		})
+	}
+	return &ast.CompositeLit{
+		Type: &ast.SelectorExpr{
+			X:   &ast.Ident{Name: runtimeName},
+			Sel: &ast.Ident{Name: depSourceType},
+		},
+		Elts: elts,
 	}
 }
 
 func checkGenDecl(genDecl *ast.GenDecl) (bool, *ast.Ident, *ast.StructType) {
+	if len(genDecl.Specs) == 0 {
+		return false, nil, nil
+	}
 	spec, isType := genDecl.Specs[0].(*ast.TypeSpec)
 	if !isType {
 		return false, nil, nil
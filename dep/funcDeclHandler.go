@@ -1,9 +1,8 @@
 package dep
 
 import (
-	"fmt"
 	"go/ast"
-	"strings"
+	"go/types"
 )
 
 type funcDeclHandler struct {
@@ -11,6 +10,8 @@ type funcDeclHandler struct {
 	fileCtx         *fileCtx
 	cmdTagCheckFunc func(codeTag string) bool
 	fieldHandler    *FieldHandler
+	checker         *annotationChecker
+	namer           *namer
 }
 
 func (h *funcDeclHandler) Handle(decl ast.Decl) (*globalNewFunc, error) {
@@ -21,49 +22,73 @@ func (h *funcDeclHandler) Handle(decl ast.Decl) (*globalNewFunc, error) {
 	if !hasAutodigDocFunc(funcDecl) {
 		return nil, nil
 	}
-	newFuncDecl, comment, err := h.buildFuncDeclByFunc(funcDecl)
+	newFuncDecl, comment, provider, err := h.buildFuncDeclByFunc(funcDecl)
 	if err != nil {
 		return nil, err
 	}
 	if newFuncDecl == nil {
 		return nil, nil
 	}
-	if comment.outGroup == "" {
-		comment.outGroup = GroupNameDefault
-	}
 	return &globalNewFunc{
 		decl:      newFuncDecl,
 		groupName: comment.outGroup,
 		name:      comment.name,
+		provider:  provider,
 	}, nil
 }
 
-func (h *funcDeclHandler) buildFuncDeclByFunc(funcDecl *ast.FuncDecl) (*ast.FuncDecl, *comment, error) {
-	var comment *comment
-	for i := 0; i < len(funcDecl.Doc.List); i++ {
-		comment = parseComment(funcDecl.Doc.List[i].Text)
-		if comment != nil {
-			break
-		}
-	}
+func (h *funcDeclHandler) buildFuncDeclByFunc(funcDecl *ast.FuncDecl) (*ast.FuncDecl, *comment, *Provider, error) {
+	commentNode, comment := findComment(funcDecl.Doc)
 	if comment == nil {
-		return nil, nil, fmt.Errorf("parse func decl err, funcName:%s, file:%s", funcDecl.Name.Name, h.fileCtx.file)
+		return nil, nil, nil, newPosError(funcDecl.Pos(), "parse func decl err, funcName:%s", funcDecl.Name.Name)
+	}
+	h.checker.reportProblems(commentNode.Pos(), comment.problems)
+	if funcDecl.Recv != nil {
+		h.checker.report(commentNode.Pos(), "@autodig is not supported on method %s, it is ignored", funcDecl.Name.Name)
+		return nil, nil, nil, nil
 	}
 	if !h.cmdTagCheckFunc(comment.tag) {
-		return nil, nil, nil
+		return nil, nil, nil, nil
 	}
+	if comment.outGroup == "" {
+		comment.outGroup = GroupNameDefault
+	}
+	provider := h.fileCtx.newProvider(funcDecl.Name, commentNode, comment)
 	err := h.changeFieldsImports(funcDecl.Type.Params)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	err = h.changeFieldsImports(funcDecl.Type.Results)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+	h.fillProvider(provider, funcDecl)
 	h.fillFuncBody(funcDecl)
-	funcDecl.Name.Name = fmt.Sprintf("%s_%s", h.fileCtx.importGlobalName, funcDecl.Name.Name)
+	funcName, err := h.namer.funcWrapperName(h.fileCtx.importGlobalName, funcDecl.Name.Name)
+	if err != nil {
+		return nil, nil, nil, newPosError(funcDecl.Name.Pos(), "%v", err)
+	}
+	funcDecl.Name.Name = funcName
 	funcDecl.Doc = nil
-	return funcDecl, comment, nil
+	provider.Func = funcDecl.Name.Name
+	return funcDecl, comment, provider, nil
+}
+
+// fillProvider 参数为依赖, 除error外的返回值为提供的类型
+func (h *funcDeclHandler) fillProvider(provider *Provider, funcDecl *ast.FuncDecl) {
+	for _, param := range funcDecl.Type.Params.List {
+		provider.Deps = append(provider.Deps, newDependency(h.fileCtx.fset, h.importCtx, param, "", ""))
+	}
+	if funcDecl.Type.Results == nil {
+		return
+	}
+	for _, result := range funcDecl.Type.Results.List {
+		typ := types.ExprString(result.Type)
+		if typ == "error" {
+			continue
+		}
+		provider.addProvide(typ, h.importCtx.typeKey(result.Type))
+	}
 }
 
 func (h *funcDeclHandler) changeFieldsImports(fields *ast.FieldList) error {
@@ -104,13 +129,5 @@ func (h *funcDeclHandler) fillFuncBody(funcDecl *ast.FuncDecl) {
 }
 
 func hasAutodigDocFunc(funcDecl *ast.FuncDecl) bool {
-	if funcDecl.Doc == nil || len(funcDecl.Doc.List) == 0 {
-		return false
-	}
-	for _, comment := range funcDecl.Doc.List {
-		if strings.Contains(comment.Text, "@autodig") {
-			return true
-		}
-	}
-	return false
+	return hasAutodigComment(funcDecl.Doc)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 	"strings"
 )
 
@@ -12,6 +13,9 @@ type genDeclHandler struct {
 	fileCtx         *fileCtx
 	cmdTagCheckFunc func(codeTag string) bool
 	fieldHandler    *FieldHandler
+	checker         *annotationChecker
+	implChecker     *implChecker
+	namer           *namer
 }
 
 func (h *genDeclHandler) Handle(decl ast.Decl) (*globalNewFunc, error) {
@@ -22,61 +26,110 @@ func (h *genDeclHandler) Handle(decl ast.Decl) (*globalNewFunc, error) {
 	if !hasAutodigDoc(genDecl) {
 		return nil, nil
 	}
-	structName, comment, newFuncDecl, err := h.buildNewFuncByGenDecl(genDecl)
-	if err != nil {
-		return nil, err
+	return h.buildNewFuncByGenDecl(genDecl)
+}
+
+func (h *genDeclHandler) buildNewFuncByGenDecl(genDecl *ast.GenDecl) (*globalNewFunc, error) {
+	commentNode, comment := findComment(genDecl.Doc)
+	valid, structNameIdent, specType := checkGenDecl(genDecl)
+	if !valid {
+		h.checker.report(commentNode.Pos(), "@autodig is only supported on struct types and funcs, %s is ignored", describeGenDecl(genDecl))
+		return nil, nil
 	}
-	if newFuncDecl == nil {
+	h.checker.reportProblems(commentNode.Pos(), comment.problems)
+	if !h.cmdTagCheckFunc(comment.tag) {
 		return nil, nil
 	}
 	if comment.outGroup == "" {
 		comment.outGroup = GroupNameDefault
 	}
+	provider := h.fileCtx.newProvider(structNameIdent, commentNode, comment)
+	newFuncDecl, assertDecl, err := h.buildNewFuncByStruct(structNameIdent, specType, provider)
+	if err != nil {
+		return nil, err
+	}
+	provider.Func = newFuncDecl.Name.Name
 	return &globalNewFunc{
 		decl:       newFuncDecl,
-		structName: structName,
+		assertDecl: assertDecl,
+		structName: structNameIdent.Name,
 		groupName:  comment.outGroup,
 		name:       comment.name,
+		provider:   provider,
 	}, nil
 }
 
-func (h *genDeclHandler) buildNewFuncByGenDecl(genDecl *ast.GenDecl) (structName string, comment *comment, newFunc *ast.FuncDecl, err error) {
-	valid, structNameIdent, specType := checkGenDecl(genDecl)
-	if !valid {
-		return
-	}
-	structName = structNameIdent.Name
-	for i := 0; i < len(genDecl.Doc.List); i++ {
-		comment = parseComment(genDecl.Doc.List[i].Text)
-		if comment != nil {
-			break
-		}
-	}
-	if comment != nil {
-		if !h.cmdTagCheckFunc(comment.tag) {
-			return
-		}
-	}
-	newFunc, err = h.buildNewFuncByStruct(structNameIdent, specType)
-	return
-}
-
-func (h *genDeclHandler) buildNewFuncByStruct(structName *ast.Ident, specType *ast.StructType) (*ast.FuncDecl, error) {
+func (h *genDeclHandler) buildNewFuncByStruct(structName *ast.Ident, specType *ast.StructType, provider *Provider) (*ast.FuncDecl, ast.Decl, error) {
 	structFieldInfo, err := h.scanFieldInStruct(specType)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if structFieldInfo.markReturnField != nil {
+		err = h.checkMarkReturnImplemented(structName, structFieldInfo.markReturnField)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 	results, err := h.buildNewFuncReturn(structFieldInfo.markReturnField, structName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	var assertDecl ast.Decl
+	if structFieldInfo.markReturnField != nil {
+		assertDecl = h.buildAssertDecl(structName, results.List[0].Type)
 	}
 	params, elts, err := h.buildParams(structFieldInfo, structName)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	provider.addProvide(types.ExprString(results.List[0].Type), h.importCtx.typeKey(results.List[0].Type))
+	for _, field := range structFieldInfo.noTagFields {
+		provider.Deps = append(provider.Deps, newDependency(h.fileCtx.fset, h.importCtx, field, "", ""))
+	}
+	for _, tagField := range structFieldInfo.tagFields {
+		provider.Deps = append(provider.Deps, newDependency(h.fileCtx.fset, h.importCtx, tagField.field, tagField.name, tagField.group))
 	}
 	newFuncBody := h.buildNewFuncBody(structName, elts, structFieldInfo)
-	newFunc := h.constituteNewFunc(structName, params, results, newFuncBody)
-	return newFunc, nil
+	newFunc, err := h.constituteNewFunc(structName, params, results, newFuncBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newFunc, assertDecl, nil
+}
+
+// checkMarkReturnImplemented 构造函数返回的是&struct, 所以检查*Struct是否实现了DigReturn的interface
+func (h *genDeclHandler) checkMarkReturnImplemented(structName *ast.Ident, markReturnField *ast.Field) error {
+	ifaceName, missing, err := h.implChecker.missingMethods(h.fileCtx.importGlobalPath, structName.Name)
+	if err != nil {
+		if _, ok := err.(*notInterfaceError); ok {
+			return newPosError(markReturnField.Pos(), "%v", err)
+		}
+		h.checker.diags.Warnf(h.fileCtx.fset.Position(markReturnField.Pos()), "cannot verify *%s implements %s: %v", structName.Name, ReturnFieldName, err)
+		return nil
+	}
+	if len(missing) > 0 {
+		return newPosError(markReturnField.Pos(), "*%s does not implement %s (missing methods: %s)", structName.Name, ifaceName, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// buildAssertDecl var _ Iface = (*Struct)(nil)
+func (h *genDeclHandler) buildAssertDecl(structName *ast.Ident, ifaceExpr ast.Expr) ast.Decl {
+	var structExpr ast.Expr = structName
+	if h.fileCtx.importGlobalPath != h.importCtx.outputImportPath {
+		structExpr = &ast.SelectorExpr{X: &ast.Ident{Name: h.fileCtx.importGlobalName}, Sel: structName}
+	}
+	return &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{
+			Names: []*ast.Ident{{Name: "_"}},
+			Type:  ifaceExpr,
+			Values: []ast.Expr{&ast.CallExpr{
+				Fun:  &ast.ParenExpr{X: &ast.StarExpr{X: structExpr}},
+				Args: []ast.Expr{&ast.Ident{Name: "nil"}},
+			}},
+		}},
+	}
 }
 
 func (h *genDeclHandler) scanFieldInStruct(specType *ast.StructType) (*structFieldInfo, error) {
@@ -95,12 +148,14 @@ func (h *genDeclHandler) scanFieldInStruct(specType *ast.StructType) (*structFie
 		}
 		fieldInfo := initFieldInfo
 		fieldInfo = parseFieldInfo(field)
+		h.checker.reportFieldProblems(field, fieldInfo.problems)
 		if fieldInfo.ignore {
 			continue
 		}
 		if fieldInfo.isReturn {
 			result.markReturnField = field
 		} else {
+			h.checker.checkBuiltinInjection(field, fieldInfo.name)
 			if fieldInfo.inGroup == "" && fieldInfo.name == "" {
 				result.noTagFields = append(result.noTagFields, field)
 			} else {
@@ -152,7 +207,6 @@ func (h *genDeclHandler) buildMarkReturn(field *ast.Field) (ast.FieldList, error
 	var results ast.FieldList
 	resultExpr, err := h.fieldHandler.changeImportExpr(field.Type)
 	if err != nil {
-		fmt.Println("===========buildMarkReturn err")
 		return results, err
 	}
 	results = ast.FieldList{List: []*ast.Field{{
@@ -169,7 +223,7 @@ func (h *genDeclHandler) buildParams(structFieldInfo *structFieldInfo, structNam
 	if len(structFieldInfo.tagFields) > 0 {
 		inGroupParam, inGroupElts, buildParamErr := h.buildInGroupParam(structFieldInfo.tagFields, structName)
 		if buildParamErr != nil {
-			return nil, nil, err
+			return nil, nil, buildParamErr
 		}
 		params = append(params, inGroupParam)
 		elts = append(elts, inGroupElts...)
@@ -196,9 +250,8 @@ func (h *genDeclHandler) handleEachInGroupField(fieldwithTag *fieldWithTag, para
 	tag := ""
 	if fieldwithTag.group != "" {
 		// 0.校验本field是否是[]
-		_, ok := fieldwithTag.field.Type.(*ast.ArrayType)
-		if !ok {
-			return nil, nil, fmt.Errorf("%s-%s should be array", h.fileCtx.file, fieldwithTag.field.Names[0].Name)
+		if !IsInGroupType(fieldwithTag.field.Type) {
+			return nil, nil, newPosError(fieldwithTag.field.Pos(), "%s with ingroup:%s should be a slice, got %s", fieldwithTag.field.Names[0].Name, fieldwithTag.group, types.ExprString(fieldwithTag.field.Type))
 		}
 		tag += fmt.Sprintf("group:\"%s\"", fieldwithTag.group)
 	}
@@ -279,22 +332,48 @@ func (h *genDeclHandler) buildNewFuncBody(structName *ast.Ident, elts []ast.Expr
 	return &ast.BlockStmt{List: bodyList}
 }
 
-func (h *genDeclHandler) constituteNewFunc(structName *ast.Ident, params []*ast.Field, results ast.FieldList, body *ast.BlockStmt) *ast.FuncDecl {
-	newFunc := &ast.FuncDecl{Name: &ast.Ident{Name: fmt.Sprintf("New%s%s", h.fileCtx.importGlobalName, structName.Name)}}
+func (h *genDeclHandler) constituteNewFunc(structName *ast.Ident, params []*ast.Field, results ast.FieldList, body *ast.BlockStmt) (*ast.FuncDecl, error) {
+	funcName, err := h.namer.structFuncName(h.fileCtx.importGlobalName, structName.Name)
+	if err != nil {
+		return nil, newPosError(structName.Pos(), "%v", err)
+	}
+	newFunc := &ast.FuncDecl{Name: &ast.Ident{Name: funcName}}
 	results.List = append(results.List, &ast.Field{Type: &ast.Ident{Name: "error"}})
 	newFunc.Type = &ast.FuncType{Params: &ast.FieldList{List: params}, Results: &results}
 	newFunc.Body = body
-	return newFunc
+	return newFunc, nil
 }
 
 func hasAutodigDoc(genDecl *ast.GenDecl) bool {
-	if genDecl.Doc == nil || len(genDecl.Doc.List) == 0 {
+	return hasAutodigComment(genDecl.Doc)
+}
+
+func hasAutodigComment(doc *ast.CommentGroup) bool {
+	if doc == nil || len(doc.List) == 0 {
 		return false
 	}
-	for _, comment := range genDecl.Doc.List {
+	for _, comment := range doc.List {
 		if strings.Contains(comment.Text, "@autodig") {
 			return true
 		}
 	}
 	return false
 }
+
+func describeGenDecl(genDecl *ast.GenDecl) string {
+	if len(genDecl.Specs) == 0 {
+		return fmt.Sprintf("empty %s declaration", genDecl.Tok)
+	}
+	spec, isType := genDecl.Specs[0].(*ast.TypeSpec)
+	if !isType {
+		return fmt.Sprintf("%s declaration", genDecl.Tok)
+	}
+	switch spec.Type.(type) {
+	case *ast.InterfaceType:
+		return fmt.Sprintf("interface %s", spec.Name.Name)
+	case *ast.FuncType:
+		return fmt.Sprintf("func type %s", spec.Name.Name)
+	default:
+		return fmt.Sprintf("type %s", spec.Name.Name)
+	}
+}
@@ -0,0 +1,83 @@
+package dep
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenDeclHandlerInvalidDecls(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// wantErrs 为空时期望生成成功
+		wantErrs     []string
+		wantWarnings []string
+	}{
+		{
+			name:         "empty type declaration",
+			src:          "package a\n\n// @autodig\ntype ()\n",
+			wantWarnings: []string{"a.go:3:1: @autodig is only supported on struct types and funcs, empty type declaration is ignored"},
+		},
+		{
+			name:         "empty var declaration",
+			src:          "package a\n\n// @autodig\nvar ()\n",
+			wantWarnings: []string{"a.go:3:1: @autodig is only supported on struct types and funcs, empty var declaration is ignored"},
+		},
+		{
+			name: "ingroup on an array",
+			src: `package a
+
+type Item struct{}
+
+// @autodig
+type Service struct {
+	Items [2]*Item ` + "`autodig:\"ingroup:items\"`" + `
+}
+`,
+			wantErrs: []string{"a.go:7:2: Items with ingroup:items should be a slice, got [2]*Item"},
+		},
+		{
+			name: "ingroup on a slice",
+			src: `package a
+
+type Item struct{}
+
+// @autodig
+type Service struct {
+	Items []*Item ` + "`autodig:\"ingroup:items\"`" + `
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTestModule(t, map[string]string{
+				"app/a/a.go":             tt.src,
+				"app/entrypoint/main.go": "package entrypoint\n",
+			})
+			a := NewAutodig([]string{filepath.Join(root, "app")}, filepath.Join(root, "app", "entrypoint", "autodig.go"), "")
+			_, _, err := a.Generate(context.Background())
+			if (err != nil) != (len(tt.wantErrs) > 0) {
+				t.Fatalf("Generate() err = %v, want errors %v", err, tt.wantErrs)
+			}
+			var errs, warnings []string
+			for _, d := range a.Diagnostics().List() {
+				msg := fmt.Sprintf("%s:%d:%d: %s", filepath.Base(d.Pos.Filename), d.Pos.Line, d.Pos.Column, d.Msg)
+				if d.Severity == SeverityError {
+					errs = append(errs, msg)
+				} else {
+					warnings = append(warnings, msg)
+				}
+			}
+			if strings.Join(errs, "\n") != strings.Join(tt.wantErrs, "\n") {
+				t.Errorf("errors = %q, want %q", errs, tt.wantErrs)
+			}
+			if strings.Join(warnings, "\n") != strings.Join(tt.wantWarnings, "\n") {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package dep
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"strings"
+)
+
+// Provider 一个会被注册到dig的构造函数
+type Provider struct {
+	// Func 生成的构造函数名, 如NewdemoService
+	Func string
+	// Symbol 源码中的struct/func, 如demo.Service
+	Symbol string
+	// Provides 提供的类型, 使用生成代码中的写法, 如*demo.Service
+	Provides []string
+	Name     string
+	Group    string
+	Tag      string
+	// Init 生成的构造函数会调用struct的Init() error
+	Init       bool
+	Annotation string
+	Pos        token.Position
+	// RelPos 相对module根目录的位置, 如demo/sourcecode.go:34, 会写入生成代码
+	RelPos string
+	Deps   []*Dependency
+
+	// pkgPath和ident 源码中struct/func所在的包和名字, 用于通过go/types查找类型信息
+	pkgPath string
+	ident   string
+	// typeKeys 与Provides一一对应, 用import path限定的类型, 如*github.com/x/demo.Service.
+	// Provides在package模式下相对各自的包, 比较不同包中的provider时使用typeKeys
+	typeKeys []string
+}
+
+// typeKey 第i个提供的类型的比较key, 没有typeKeys时(不是由autodig生成的Provider)使用Provides
+func (p *Provider) typeKey(i int) string {
+	if i < len(p.typeKeys) {
+		return p.typeKeys[i]
+	}
+	return p.Provides[i]
+}
+
+func (p *Provider) addProvide(typ string, key string) {
+	p.Provides = append(p.Provides, typ)
+	p.typeKeys = append(p.typeKeys, key)
+}
+
+// Dependency provider依赖的一个类型
+type Dependency struct {
+	Type  string
+	Name  string
+	Group string
+	Pos   token.Position
+	// key 用import path限定的Type, 见Provider.typeKeys
+	key string
+}
+
+func (d *Dependency) typeKey() string {
+	if d.key != "" {
+		return d.key
+	}
+	return d.Type
+}
+
+func (p *Provider) String() string {
+	return fmt.Sprintf("%s (%s)", p.Symbol, p.Pos)
+}
+
+func (d *Dependency) String() string {
+	switch {
+	case d.Group != "":
+		return fmt.Sprintf("%s ingroup:%s (%s)", d.Type, d.Group, d.Pos)
+	case d.Name != "":
+		return fmt.Sprintf("%s name:%s (%s)", d.Type, d.Name, d.Pos)
+	default:
+		return fmt.Sprintf("%s (%s)", d.Type, d.Pos)
+	}
+}
+
+// Satisfies provider能否满足dep: 非group依赖要求类型和name相同, ingroup依赖要求outgroup相同且dep的类型为[]T
+func (p *Provider) Satisfies(dep *Dependency) bool {
+	for i := range p.Provides {
+		if dep.Group != "" {
+			if p.Group == dep.Group && dep.typeKey() == "[]"+p.typeKey(i) {
+				return true
+			}
+		} else if p.Group == "" && p.Name == dep.Name && p.typeKey(i) == dep.typeKey() {
+			return true
+		}
+	}
+	return false
+}
+
+// ProvidersOf 满足dep的所有provider, 按providers中的顺序
+func ProvidersOf(providers []*Provider, dep *Dependency) []*Provider {
+	ret := make([]*Provider, 0)
+	for _, provider := range providers {
+		if provider.Satisfies(dep) {
+			ret = append(ret, provider)
+		}
+	}
+	return ret
+}
+
+func newDependency(fset *token.FileSet, importCtx *ImportCtx, field *ast.Field, name string, group string) *Dependency {
+	return &Dependency{Type: types.ExprString(field.Type), key: importCtx.typeKey(field.Type), Name: name, Group: group, Pos: fset.Position(field.Pos())}
+}
+
+// checkDuplicateProviders 同一个类型(和name)被多个非group的provider提供时, dep.MustProvide会在运行时panic
+func checkDuplicateProviders(providers []*Provider, diags *Diagnostics) {
+	first := make(map[string]*Provider)
+	for _, provider := range providers {
+		if provider.Group != "" {
+			continue
+		}
+		for i, typ := range provider.Provides {
+			key := provider.Name + ":" + provider.typeKey(i)
+			exist, ok := first[key]
+			if !ok {
+				first[key] = provider
+				continue
+			}
+			what := typ
+			if provider.Name != "" {
+				what = fmt.Sprintf("%s with name:%s", typ, provider.Name)
+			}
+			diags.Errorf(provider.Pos, "%s is provided by both %s (%s) and %s (%s), add a different name: or a tag: condition to one of them",
+				what, exist.Symbol, exist.Pos, provider.Symbol, provider.Pos)
+		}
+	}
+}
+
+// GraphReport 依赖关系中可能有问题的部分
+type GraphReport struct {
+	// UnusedProviders 提供的类型没有被任何其他provider依赖
+	UnusedProviders []*Provider
+	// EmptyGroups ingroup的group没有任何outgroup成员
+	EmptyGroups []*Dependency
+	// MissingNames 依赖的name没有任何provider提供
+	MissingNames []*Dependency
+}
+
+func BuildGraphReport(providers []*Provider) *GraphReport {
+	report := &GraphReport{}
+	groups := make(map[string]bool)
+	named := make(map[string]bool)
+	consumed := make(map[string]bool)
+	for _, provider := range providers {
+		for i := range provider.Provides {
+			if provider.Group != "" {
+				groups[provider.Group] = true
+			} else if provider.Name != "" {
+				named[provider.Name+":"+provider.typeKey(i)] = true
+			}
+		}
+		for _, dep := range provider.Deps {
+			if dep.Group != "" {
+				consumed["group:"+dep.Group+":"+dep.typeKey()] = true
+			} else {
+				consumed["name:"+dep.Name+":"+dep.typeKey()] = true
+			}
+		}
+	}
+	for _, provider := range providers {
+		used := false
+		for i := range provider.Provides {
+			if provider.Group != "" {
+				used = used || consumed["group:"+provider.Group+":[]"+provider.typeKey(i)]
+			} else {
+				used = used || consumed["name:"+provider.Name+":"+provider.typeKey(i)]
+			}
+		}
+		if !used {
+			report.UnusedProviders = append(report.UnusedProviders, provider)
+		}
+		for _, dep := range provider.Deps {
+			if dep.Group != "" && !groups[dep.Group] {
+				report.EmptyGroups = append(report.EmptyGroups, dep)
+			}
+			if dep.Group == "" && dep.Name != "" && !named[dep.Name+":"+dep.typeKey()] {
+				report.MissingNames = append(report.MissingNames, dep)
+			}
+		}
+	}
+	return report
+}
+
+func (r *GraphReport) Empty() bool {
+	return len(r.UnusedProviders) == 0 && len(r.EmptyGroups) == 0 && len(r.MissingNames) == 0
+}
+
+func (r *GraphReport) Print(w io.Writer) {
+	if r.Empty() {
+		fmt.Fprintln(w, "no unused providers, empty groups or missing names")
+		return
+	}
+	if len(r.UnusedProviders) > 0 {
+		fmt.Fprintln(w, "unused providers (not consumed by any annotated provider, may still be used by Invoke):")
+		for _, provider := range r.UnusedProviders {
+			fmt.Fprintf(w, "  %s provides %s\n", provider, describeProvided(provider))
+		}
+	}
+	if len(r.EmptyGroups) > 0 {
+		fmt.Fprintln(w, "ingroup consumers without any outgroup member:")
+		for _, dep := range r.EmptyGroups {
+			fmt.Fprintf(w, "  %s\n", dep)
+		}
+	}
+	if len(r.MissingNames) > 0 {
+		fmt.Fprintln(w, "names that no provider offers:")
+		for _, dep := range r.MissingNames {
+			fmt.Fprintf(w, "  %s\n", dep)
+		}
+	}
+}
+
+func describeProvided(provider *Provider) string {
+	ret := strings.Join(provider.Provides, ", ")
+	if provider.Group != "" {
+		ret += " outgroup:" + provider.Group
+	}
+	if provider.Name != "" {
+		ret += " name:" + provider.Name
+	}
+	return ret
+}
@@ -0,0 +1,161 @@
+package dep
+
+import (
+	"bytes"
+	"context"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDuplicateProviders(t *testing.T) {
+	newProvider := func(symbol string, line int, name, group string, provides ...string) *Provider {
+		return &Provider{Symbol: symbol, Provides: provides, Name: name, Group: group, Pos: token.Position{Filename: "a.go", Line: line}}
+	}
+	tests := []struct {
+		name      string
+		providers []*Provider
+		// want 每个error中应包含的内容, 按报告顺序
+		want []string
+	}{
+		{
+			name: "different types",
+			providers: []*Provider{
+				newProvider("a.NewClient", 1, "", "", "*a.Client"),
+				newProvider("a.Service", 2, "", "", "*a.Service"),
+			},
+		},
+		{
+			name: "same type",
+			providers: []*Provider{
+				newProvider("a.NewClient", 1, "", "", "*a.Client"),
+				newProvider("a.NewOtherClient", 5, "", "", "*a.Client"),
+			},
+			want: []string{"*a.Client is provided by both a.NewClient (a.go:1) and a.NewOtherClient (a.go:5)"},
+		},
+		{
+			name: "same type with different names",
+			providers: []*Provider{
+				newProvider("a.NewClient", 1, "", "", "*a.Client"),
+				newProvider("a.NewAbClient", 5, "ab", "", "*a.Client"),
+			},
+		},
+		{
+			name: "same type with same name",
+			providers: []*Provider{
+				newProvider("a.NewClient", 1, "ab", "", "*a.Client"),
+				newProvider("a.NewAbClient", 5, "ab", "", "*a.Client"),
+			},
+			want: []string{"*a.Client with name:ab is provided by both"},
+		},
+		{
+			name: "group members",
+			providers: []*Provider{
+				newProvider("a.NewLogger", 1, "", "loggers", "a.Logger"),
+				newProvider("a.NewFileLogger", 5, "", "loggers", "a.Logger"),
+			},
+		},
+		{
+			name: "group member and plain provider",
+			providers: []*Provider{
+				newProvider("a.NewLogger", 1, "", "loggers", "a.Logger"),
+				newProvider("a.NewDefaultLogger", 5, "", "", "a.Logger"),
+			},
+		},
+		{
+			name: "three providers of the same type",
+			providers: []*Provider{
+				newProvider("a.Controller", 1, "", "", "a.ControllerI"),
+				newProvider("a.OtherController", 5, "", "", "a.ControllerI"),
+				newProvider("a.ThirdController", 9, "", "", "a.ControllerI"),
+			},
+			want: []string{
+				"a.ControllerI is provided by both a.Controller (a.go:1) and a.OtherController (a.go:5)",
+				"a.ControllerI is provided by both a.Controller (a.go:1) and a.ThirdController (a.go:9)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := NewDiagnostics(0)
+			checkDuplicateProviders(tt.providers, diags)
+			list := diags.List()
+			if len(list) != len(tt.want) {
+				t.Fatalf("got %d diagnostics %v, want %d", len(list), list, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if list[i].Severity != SeverityError || !strings.Contains(list[i].Msg, want) {
+					t.Errorf("diagnostic %d = %v, want error containing %q", i, list[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestGraphReport(t *testing.T) {
+	root := newTestModule(t, map[string]string{
+		"app/a/a.go": `package a
+
+type Logger interface{}
+
+type Handler interface{}
+
+type Client struct{}
+
+// @autodig
+func NewClient() *Client {
+	return &Client{}
+}
+
+// @autodig name:primary
+func NewPrimaryClient() *Client {
+	return &Client{}
+}
+
+// @autodig outgroup:loggers
+func NewLogger() Logger {
+	return nil
+}
+
+// @autodig
+type Service struct {
+	Client   *Client   ` + "`autodig:\"name:backup\"`" + `
+	Loggers  []Logger  ` + "`autodig:\"ingroup:loggers\"`" + `
+	Handlers []Handler ` + "`autodig:\"ingroup:handlers\"`" + `
+}
+
+// @autodig
+type Worker struct {
+	Client *Client
+}
+`,
+		"app/entrypoint/main.go": "package entrypoint\n",
+	})
+	a := NewAutodig([]string{filepath.Join(root, "app")}, filepath.Join(root, "app", "entrypoint", "autodig.go"), "")
+	if _, _, err := a.Generate(context.Background()); err != nil {
+		t.Fatalf("Generate() err: %v", err)
+	}
+	buffer := &bytes.Buffer{}
+	a.Report().Print(buffer)
+	got := strings.ReplaceAll(buffer.String(), filepath.Join(root, "app", "a")+string(filepath.Separator), "")
+	// NewClient被Worker使用, NewLogger是loggers的成员, 都不会出现在报告中
+	want := `unused providers (not consumed by any annotated provider, may still be used by Invoke):
+  a.NewPrimaryClient (a.go:15:6) provides *a.Client name:primary
+  a.Service (a.go:25:6) provides *a.Service
+  a.Worker (a.go:32:6) provides *a.Worker
+ingroup consumers without any outgroup member:
+  []a.Handler ingroup:handlers (a.go:28:2)
+names that no provider offers:
+  *a.Client name:backup (a.go:26:2)
+`
+	if got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+
+	buffer.Reset()
+	BuildGraphReport(nil).Print(buffer)
+	if want := "no unused providers, empty groups or missing names\n"; buffer.String() != want {
+		t.Errorf("Print() of an empty report = %q, want %q", buffer.String(), want)
+	}
+}
@@ -0,0 +1,281 @@
+package dep
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// implChecker 检查DigReturn指定的interface是否真的被*Struct实现.
+// 只对声明struct的包做源码类型检查, 依赖的包从go list -export编译得到的export data中读取. 所有检查通过mu串行执行
+type implChecker struct {
+	mu       sync.Mutex
+	fset     *token.FileSet
+	env      BuildEnv
+	dir      string
+	pkgFiles map[string][]string
+	pkgs     map[string]*types.Package
+	loadErrs map[string]error
+	cache    *loadCache
+}
+
+func newImplChecker(importCtx *ImportCtx) *implChecker {
+	pkgFiles := make(map[string][]string)
+	for file, pkgPath := range importCtx.localFileImportMap {
+		pkgFiles[pkgPath] = append(pkgFiles[pkgPath], file)
+	}
+	checker := newImplCheckerWithFiles(pkgFiles, importCtx.buildEnv, importCtx.dir)
+	checker.cache = importCtx.cache
+	return checker
+}
+
+// newImplCheckerWithFiles pkgFiles为每个包需要类型检查的文件, 没有指定的包检查packages.Load得到的GoFiles.
+// 在dir所在的module中按env加载包
+func newImplCheckerWithFiles(pkgFiles map[string][]string, env BuildEnv, dir string) *implChecker {
+	return &implChecker{
+		fset:     token.NewFileSet(),
+		env:      env,
+		dir:      dir,
+		pkgFiles: pkgFiles,
+		pkgs:     make(map[string]*types.Package),
+		loadErrs: make(map[string]error),
+	}
+}
+
+// missingMethods 返回*structName缺少的DigReturn interface方法, 无法完成类型检查时返回error.
+// 结果会缓存, struct、interface和方法所在的目录没有变化时不再做类型检查
+func (c *implChecker) missingMethods(pkgPath string, structName string) (string, []string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := "impl:" + pkgPath + "." + structName
+	if cached := c.cache.getImpl(key); cached != nil {
+		if cached.NotInterface {
+			return cached.IfaceName, nil, &notInterfaceError{typeName: cached.IfaceName}
+		}
+		return cached.IfaceName, cached.Missing, nil
+	}
+	dirs := make(map[string]bool)
+	ifaceName, missing, err := c.resolveMissingMethods(pkgPath, structName, dirs)
+	_, notInterface := err.(*notInterfaceError)
+	if err == nil || notInterface {
+		c.cache.putImpl(key, &cachedImpl{IfaceName: ifaceName, Missing: missing, NotInterface: notInterface}, dirs)
+	}
+	return ifaceName, missing, err
+}
+
+// resolveMissingMethods dirs中记录会影响结果的声明所在的目录
+func (c *implChecker) resolveMissingMethods(pkgPath string, structName string, dirs map[string]bool) (ifaceName string, missing []string, err error) {
+	addDir := func(pos token.Pos) {
+		if file := c.fset.Position(pos).Filename; file != "" {
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+	pkg, err := c.load(pkgPath)
+	if err != nil {
+		return "", nil, err
+	}
+	obj, ok := pkg.Scope().Lookup(structName).(*types.TypeName)
+	if !ok {
+		return "", nil, fmt.Errorf("type %s not found in %s", structName, pkgPath)
+	}
+	addDir(obj.Pos())
+	structType, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		return "", nil, fmt.Errorf("%s is not a struct", structName)
+	}
+	var returnType types.Type
+	for i := 0; i < structType.NumFields(); i++ {
+		if structType.Field(i).Name() == ReturnFieldName {
+			returnType = structType.Field(i).Type()
+		}
+	}
+	if returnType == nil {
+		return "", nil, fmt.Errorf("%s.%s not found", structName, ReturnFieldName)
+	}
+	qualifier := types.RelativeTo(pkg)
+	ifaceName = types.TypeString(returnType, qualifier)
+	// named类型和alias都有Obj(), 记录声明DigReturn类型的目录, 类型修改后重新检查
+	if declared, ok := returnType.(interface{ Obj() *types.TypeName }); ok {
+		addDir(declared.Obj().Pos())
+	}
+	// 类型无法解析(如引用了还未生成的代码)时无法判断, 由调用方报告warning, 结果不缓存
+	if hasInvalidType(returnType) {
+		return ifaceName, nil, fmt.Errorf("cannot resolve type %s", ifaceName)
+	}
+	iface, ok := returnType.Underlying().(*types.Interface)
+	if !ok {
+		return ifaceName, nil, &notInterfaceError{typeName: ifaceName}
+	}
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		if hasInvalidType(iface.EmbeddedType(i)) {
+			return ifaceName, nil, fmt.Errorf("cannot resolve type %s embedded in %s", types.TypeString(iface.EmbeddedType(i), qualifier), ifaceName)
+		}
+	}
+	ptr := types.NewPointer(obj.Type())
+	for i := 0; i < iface.NumMethods(); i++ {
+		method := iface.Method(i)
+		addDir(method.Pos())
+		if hasInvalidType(method.Type()) {
+			return ifaceName, nil, fmt.Errorf("cannot resolve the signature of %s.%s", ifaceName, method.Name())
+		}
+		if found, _, _ := types.LookupFieldOrMethod(ptr, false, method.Pkg(), method.Name()); found != nil {
+			addDir(found.Pos())
+			if hasInvalidType(found.Type()) {
+				return ifaceName, nil, fmt.Errorf("cannot resolve the signature of (*%s).%s", structName, found.Name())
+			}
+		}
+	}
+	if types.Implements(ptr, iface) {
+		return ifaceName, nil, nil
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		method := iface.Method(i)
+		found, _, _ := types.LookupFieldOrMethod(ptr, false, method.Pkg(), method.Name())
+		signature := strings.TrimPrefix(types.TypeString(method.Type(), qualifier), "func")
+		if found == nil {
+			missing = append(missing, method.Name()+signature)
+		} else if !types.Identical(found.Type(), method.Type()) {
+			missing = append(missing, fmt.Sprintf("%s%s (has %s%s)", method.Name(), signature, found.Name(), strings.TrimPrefix(types.TypeString(found.Type(), qualifier), "func")))
+		}
+	}
+	return ifaceName, missing, nil
+}
+
+func (c *implChecker) load(pkgPath string) (*types.Package, error) {
+	if pkg, ok := c.pkgs[pkgPath]; ok {
+		return pkg, nil
+	}
+	if err, ok := c.loadErrs[pkgPath]; ok {
+		return nil, err
+	}
+	c.preload([]string{pkgPath})
+	if err, ok := c.loadErrs[pkgPath]; ok {
+		return nil, err
+	}
+	return c.pkgs[pkgPath], nil
+}
+
+// preload 一次go list加载pkgPaths, 逐个类型检查. 结果和错误记录在pkgs和loadErrs中
+func (c *implChecker) preload(pkgPaths []string) {
+	patterns := make([]string, 0, len(pkgPaths))
+	for _, pkgPath := range pkgPaths {
+		if _, ok := c.pkgs[pkgPath]; ok {
+			continue
+		}
+		if _, ok := c.loadErrs[pkgPath]; ok {
+			continue
+		}
+		patterns = append(patterns, pkgPath)
+	}
+	if len(patterns) == 0 {
+		return
+	}
+	config := c.env.packagesConfig(packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedExportsFile)
+	config.Dir = c.dir
+	loaded, err := packages.Load(config, patterns...)
+	if err != nil {
+		for _, pkgPath := range patterns {
+			c.loadErrs[pkgPath] = err
+		}
+		return
+	}
+	for _, pkg := range loaded {
+		c.check(pkg)
+	}
+	for _, pkgPath := range patterns {
+		if _, ok := c.pkgs[pkgPath]; !ok {
+			if _, ok := c.loadErrs[pkgPath]; !ok {
+				c.loadErrs[pkgPath] = fmt.Errorf("package %s not found", pkgPath)
+			}
+		}
+	}
+}
+
+// check 从源码类型检查pkg, import的包使用export data.
+// 包内可能引用了还未生成的代码, 依赖的包也可能因此编译失败, 忽略类型错误, 无法解析的类型为types.Typ[types.Invalid]
+func (c *implChecker) check(pkg *packages.Package) {
+	names := c.pkgFiles[pkg.ID]
+	if len(names) == 0 {
+		names = pkg.GoFiles
+	}
+	if len(names) == 0 {
+		if len(pkg.Errors) > 0 {
+			c.loadErrs[pkg.ID] = pkg.Errors[0]
+		} else {
+			c.loadErrs[pkg.ID] = fmt.Errorf("no go files in %s", pkg.ID)
+		}
+		return
+	}
+	files := make([]*ast.File, 0, len(names))
+	for _, name := range names {
+		file, err := parser.ParseFile(c.fset, name, nil, 0)
+		if err != nil {
+			c.loadErrs[pkg.ID] = err
+			return
+		}
+		files = append(files, file)
+	}
+	lookup := func(path string) (io.ReadCloser, error) {
+		imported, ok := pkg.Imports[path]
+		if !ok || imported.ExportFile == "" {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(imported.ExportFile)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(c.fset, "gc", lookup), Error: func(error) {}}
+	checked, err := conf.Check(pkg.ID, c.fset, files, nil)
+	if checked == nil {
+		c.loadErrs[pkg.ID] = err
+		return
+	}
+	c.pkgs[pkg.ID] = checked
+}
+
+// hasInvalidType t中是否有无法解析的类型. 只展开非named类型, 避免递归类型
+func hasInvalidType(t types.Type) bool {
+	if basic, ok := t.Underlying().(*types.Basic); ok {
+		return basic.Kind() == types.Invalid
+	}
+	if _, ok := t.(*types.Named); ok {
+		return false
+	}
+	switch t := t.Underlying().(type) {
+	case *types.Pointer:
+		return hasInvalidType(t.Elem())
+	case *types.Slice:
+		return hasInvalidType(t.Elem())
+	case *types.Array:
+		return hasInvalidType(t.Elem())
+	case *types.Chan:
+		return hasInvalidType(t.Elem())
+	case *types.Map:
+		return hasInvalidType(t.Key()) || hasInvalidType(t.Elem())
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if hasInvalidType(t.At(i).Type()) {
+				return true
+			}
+		}
+	case *types.Signature:
+		return hasInvalidType(t.Params()) || hasInvalidType(t.Results())
+	}
+	return false
+}
+
+type notInterfaceError struct {
+	typeName string
+}
+
+func (e *notInterfaceError) Error() string {
+	return fmt.Sprintf("%s should be an interface type, got %s", ReturnFieldName, e.typeName)
+}
@@ -0,0 +1,111 @@
+package dep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImplCheckerMissingMethods(t *testing.T) {
+	root := newTestModule(t, map[string]string{
+		"api/api.go": `package api
+
+import (
+	"context"
+	"io"
+)
+
+type Store interface {
+	io.Closer
+	Get(ctx context.Context, id int64) (string, error)
+	Put(ctx context.Context, id int64, value string) error
+}
+`,
+		"impl/impl.go": `package impl
+
+import (
+	"context"
+
+	"example.com/x/api"
+)
+
+type Partial struct {
+	DigReturn api.Store
+}
+
+func (p *Partial) Get(ctx context.Context, id int64) (string, error) {
+	return "", nil
+}
+
+func (p *Partial) Put(id int64, value string) error {
+	return nil
+}
+
+type Full struct {
+	DigReturn api.Store
+}
+
+func (f *Full) Close() error { return nil }
+
+func (f *Full) Get(ctx context.Context, id int64) (string, error) {
+	return "", nil
+}
+
+func (f *Full) Put(ctx context.Context, id int64, value string) error {
+	return nil
+}
+
+// Unresolved 引用了还未生成的代码, 仍然可以检查DigReturn
+type Unresolved struct {
+	DigReturn api.Store
+	Gen       generated
+}
+
+type NotIface struct {
+	DigReturn *Full
+}
+`,
+	})
+	tests := []struct {
+		structName  string
+		wantIface   string
+		wantMissing []string
+		wantErr     string
+	}{
+		{
+			structName: "Partial",
+			wantIface:  "example.com/x/api.Store",
+			wantMissing: []string{
+				"Close() error",
+				"Put(ctx context.Context, id int64, value string) error (has Put(id int64, value string) error)",
+			},
+		},
+		{structName: "Full", wantIface: "example.com/x/api.Store"},
+		{
+			structName:  "Unresolved",
+			wantIface:   "example.com/x/api.Store",
+			wantMissing: []string{"Close() error", "Get(ctx context.Context, id int64) (string, error)", "Put(ctx context.Context, id int64, value string) error"},
+		},
+		{structName: "NotIface", wantIface: "*Full", wantErr: "should be an interface type"},
+		{structName: "Missing", wantErr: "not found"},
+	}
+	checker := newImplCheckerWithFiles(nil, BuildEnv{}, root)
+	for _, tt := range tests {
+		t.Run(tt.structName, func(t *testing.T) {
+			iface, missing, err := checker.missingMethods("example.com/x/impl", tt.structName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("missingMethods() err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("missingMethods() err: %v", err)
+			}
+			if iface != tt.wantIface {
+				t.Errorf("iface = %q, want %q", iface, tt.wantIface)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("missing = %q, want %q", missing, tt.wantMissing)
+			}
+		})
+	}
+}
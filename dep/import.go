@@ -1,12 +1,15 @@
 package dep
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
-	"go/parser"
 	"go/token"
-	"io/ioutil"
+	"go/types"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
 	"golang.org/x/tools/go/packages"
@@ -22,10 +25,24 @@ type ImportHandler interface {
 }
 
 type importHandler struct {
+	runtimePath string
+	buildEnv    BuildEnv
+	cache       *loadCache
+	// sources 为nil时每次GetAllImports重新解析
+	sources *sourceSet
+	// ctx 取消时停止加载包, 为nil时不会取消
+	ctx context.Context
+	// dir 在输出文件所在的module中加载包, 为空时使用当前目录
+	dir string
 }
 
-func NewImportHandler() ImportHandler {
-	return &importHandler{}
+// NewImportHandler runtimePath为生成代码中调用MustProvide/ProvideTo等函数的包, 为空时使用dep包.
+// 加载包时使用buildEnv中的GOOS/GOARCH和build tags
+func NewImportHandler(runtimePath string, buildEnv BuildEnv) ImportHandler {
+	if runtimePath == "" {
+		runtimePath = depImportPath
+	}
+	return &importHandler{runtimePath: runtimePath, buildEnv: buildEnv}
 }
 
 type ImportCtx struct {
@@ -33,20 +50,25 @@ type ImportCtx struct {
 	localFileImportMap map[string]string
 	outputImportPath   string
 	outputPkgName      string
+	runtimePath        string
 	globalImportDecl   *ast.GenDecl
+	cache              *loadCache
+	sources            *sourceSet
+	buildEnv           BuildEnv
+	// dir 加载包时使用的目录, 为空时使用当前目录
+	dir string
+}
+
+// runtimeName 生成代码中运行时包的别名
+func (i *ImportCtx) runtimeName() string {
+	return i.getGlobalImportNameByPath(i.runtimePath)
 }
 
 func (i *ImportCtx) getGlobalImportNameByPath(path string) string {
-	if _, ok := i.globalImportMap[path]; !ok {
-		fmt.Println(path)
-	}
 	return i.globalImportMap[path].globalName
 }
 
 func (i *ImportCtx) getGlobalImportNameByFile(file string) string {
-	if _, ok := i.globalImportMap[i.getGlobalImportPathByFile(file)]; !ok {
-		fmt.Println(file)
-	}
 	return i.globalImportMap[i.getGlobalImportPathByFile(file)].globalName
 }
 
@@ -54,66 +76,67 @@ func (i *ImportCtx) getGlobalImportPathByFile(file string) string {
 	return i.localFileImportMap[file]
 }
 
-type importName struct {
-	name       string
-	globalName string
-}
-
-func (a *Autodig) getAllFiles(dirs []string) ([]string, error) {
-	files := make([]string, 0)
-	for _, dir := range dirs {
-		eachDirFiles, err := a.getFilesInOneDir(dir)
-		if err != nil {
-			return files, fmt.Errorf("getAllFiles err :%v", err)
-		}
-		files = append(files, eachDirFiles...)
-	}
-	return files, nil
-}
-
-func (a *Autodig) getFilesInOneDir(dirPath string) (files []string, err error) {
-	dir, err := ioutil.ReadDir(dirPath)
-	if err != nil {
-		return nil, err
+// typeKey 把生成代码中的类型表达式中的import别名替换为import path, 输出包中的类型也加上输出包的path,
+// 得到与生成到哪个包无关的类型, 如*github.com/x/demo.Service
+func (i *ImportCtx) typeKey(expr ast.Expr) string {
+	paths := make(map[string]string, len(i.globalImportMap))
+	for path, name := range i.globalImportMap {
+		paths[name.globalName] = path
 	}
-	pthSep := string(os.PathSeparator)
-	for _, fi := range dir {
-		fileName := fmt.Sprintf("%s%s%s", dirPath, pthSep, fi.Name())
-		if fi.IsDir() {
-			eachFiles, err := a.getFilesInOneDir(fileName)
-			if err != nil {
-				return nil, err
+	expr = cloneValue(reflect.ValueOf(expr)).Interface().(ast.Expr)
+	var qualify func(node ast.Node) bool
+	qualify = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := node.X.(*ast.Ident); ok {
+				if path, ok := paths[x.Name]; ok {
+					x.Name = path
+				}
 			}
-			files = append(files, eachFiles...)
-		} else {
-			ok := strings.HasSuffix(fi.Name(), ".go") && !strings.HasSuffix(fi.Name(), "_test.go")
-			if ok {
-				files = append(files, fileName)
+			return false
+		case *ast.Field:
+			// 跳过参数和字段的名字
+			ast.Inspect(node.Type, qualify)
+			return false
+		case *ast.Ident:
+			if _, ok := types.Universe.Lookup(node.Name).(*types.TypeName); !ok {
+				node.Name = i.outputImportPath + "." + node.Name
 			}
 		}
+		return true
 	}
-	return
+	ast.Inspect(expr, qualify)
+	return types.ExprString(expr)
+}
+
+type importName struct {
+	name       string
+	globalName string
 }
 
 func (h *importHandler) GetAllImports(files []string, outputFile string) (*ImportCtx, error) {
-	importMap, err := h.getAllImportsPath(files, outputFile)
-	if err != nil {
-		return nil, fmt.Errorf("getAllImportsPath err: %v ", err)
+	sources := h.sources
+	if sources == nil {
+		sources = newSourceSet(h.cache)
 	}
-	localFileImportMap, err := h.buildLocalFileImportPathMap(files)
+	importMap := h.getAllImportsPath(sources, files, outputFile)
+	byDir, byPath, err := h.loadPackages(packageDirs(files, outputFile), sortedImportPaths(importMap))
 	if err != nil {
-		return nil, fmt.Errorf("buildLocalFileImportPathMap err: %v ", err)
+		return nil, fmt.Errorf("loadPackages err: %v ", err)
 	}
+	localFileImportMap := buildLocalFileImportPathMap(files, byDir)
 	for _, path := range localFileImportMap {
 		addGlobalImportsMap(importMap, path)
 	}
-	err = h.nameGlobalImportsMap(importMap)
-	if err != nil {
-		return nil, fmt.Errorf("nameGlobalImportsMap err: %v ", err)
-	}
-	outputImportPath, outputImportName, err := h.getOutputImportPath(outputFile)
-	if err != nil {
-		return nil, fmt.Errorf("getOutputImportPath err: %v ", err)
+	nameGlobalImportsMap(importMap, byDir, byPath)
+	var outputImportPath, outputImportName string
+	if outputPkg, ok := byDir[filepath.Dir(outputFile)]; ok {
+		outputImportPath, outputImportName = outputPkg.ID, outputPkg.Name
+	} else {
+		outputImportPath, outputImportName, err = h.getOutputImportPath(outputFile)
+		if err != nil {
+			return nil, fmt.Errorf("getOutputImportPath err: %v ", err)
+		}
 	}
 	importGenDecl := h.buildGlobalImportSpecs(importMap)
 	importCtx := &ImportCtx{
@@ -122,39 +145,57 @@ func (h *importHandler) GetAllImports(files []string, outputFile string) (*Impor
 		outputImportPath:   outputImportPath,
 		globalImportDecl:   importGenDecl,
 		outputPkgName:      outputImportName,
+		runtimePath:        h.runtimePath,
+		cache:              h.cache,
+		sources:            sources,
+		buildEnv:           h.buildEnv,
+		dir:                h.dir,
 	}
 	return importCtx, nil
 }
 
-func (h *importHandler) getAllImportsPath(files []string, outputFile string) (map[string]*importName, error) {
-	importMap := baseGlobalImportMap
-	fset := token.NewFileSet()
-	for _, file := range files {
-		if file == outputFile {
-			continue
+// preload 提前解析所有文件并一次加载所有相关的包, 之后的GetAllImports直接使用缓存的结果.
+// 失败时忽略, 由GetAllImports报告错误
+func (h *importHandler) preload(files []string, outputFile string) {
+	if h.sources == nil {
+		h.sources = newSourceSet(h.cache)
+	}
+	importMap := h.getAllImportsPath(h.sources, files, outputFile)
+	_, _, _ = h.loadPackages(packageDirs(files, outputFile), sortedImportPaths(importMap))
+}
+
+func (h *importHandler) getAllImportsPath(sources *sourceSet, files []string, outputFile string) map[string]*importName {
+	importMap := make(map[string]*importName)
+	for path, name := range baseGlobalImportMap {
+		if path == depImportPath {
+			path = h.runtimePath
 		}
-		fileAST, fileSetErr := parser.ParseFile(fset, file, nil, parser.ParseComments)
-		if fileSetErr != nil {
-			return nil, fileSetErr
+		importMap[path] = &importName{name: name.name, globalName: name.globalName}
+	}
+	files = removeString(files, outputFile)
+	for _, parsed := range sources.parse(files) {
+		// 语法错误由fileBuilder统一记录
+		if parsed.err == nil {
+			addGlobalImportsMapBySpecs(importMap, parsed.ast.Imports)
 		}
-		addGlobalImportsMapBySpecs(importMap, fileAST.Imports)
 	}
-	return importMap, nil
+	return importMap
 }
 
-func (h *importHandler) nameGlobalImportsMap(importsMap map[string]*importName) error {
-	usedName := make(map[string]bool)
-	importsNames := make([]string, 0, len(usedName))
-	for k := range importsMap {
-		importsNames = append(importsNames, k)
+// nameGlobalImportsMap 按import path顺序分配别名, 保证重名时加"_"的结果稳定
+func nameGlobalImportsMap(importsMap map[string]*importName, byDir map[string]*cachedPackage, byPath map[string]*cachedPackage) {
+	pkgs := make(map[string]*cachedPackage)
+	for _, pkg := range byDir {
+		pkgs[pkg.ID] = pkg
 	}
-	importPkg, err := packages.Load(&packages.Config{Mode: packages.NeedName}, importsNames...)
-	if err != nil {
-		return err
+	for _, pkg := range byPath {
+		pkgs[pkg.ID] = pkg
 	}
-	for _, eachImport := range importPkg {
-		if len(eachImport.Errors) > 0 {
-			return eachImport.Errors[0]
+	usedName := make(map[string]bool)
+	for _, path := range sortedImportPaths(importsMap) {
+		eachImport, ok := pkgs[path]
+		if !ok {
+			continue
 		}
 		globalname := eachImport.Name
 		for {
@@ -167,40 +208,66 @@ func (h *importHandler) nameGlobalImportsMap(importsMap map[string]*importName)
 		}
 		importsMap[eachImport.ID] = &importName{globalName: globalname, name: eachImport.Name}
 	}
-	return nil
 }
 
-func (h *importHandler) buildLocalFileImportPathMap(files []string) (map[string]string, error) {
+func buildLocalFileImportPathMap(files []string, byDir map[string]*cachedPackage) map[string]string {
 	localFileImportPathMap := make(map[string]string)
-	paths := make([]string, len(files))
-	for i := range files {
-		paths[i] = removeFileNameInPath(files[i])
-	}
-	localImportPkg, err := packages.Load(&packages.Config{Mode: packages.NeedFiles}, paths...)
-	if err != nil {
-		return nil, fmt.Errorf("load localfilePkg err:%v", err)
-	}
-	for _, pkg := range localImportPkg {
-		for _, file := range pkg.GoFiles {
-			localFileImportPathMap[file] = pkg.ID
+	for _, file := range files {
+		pkg, ok := byDir[filepath.Dir(file)]
+		if !ok {
+			continue
 		}
-		for _, file := range pkg.IgnoredFiles {
+		// 不满足build constraints的文件(IgnoredFiles)已经在扫描时跳过
+		for _, goFile := range pkg.GoFiles {
+			localFileImportPathMap[goFile] = pkg.ID
+		}
+		// 没有加载测试, _test.go属于同目录下的包
+		if strings.HasSuffix(file, "_test.go") {
 			localFileImportPathMap[file] = pkg.ID
 		}
 	}
-	return localFileImportPathMap, nil
+	return localFileImportPathMap
+}
+
+// packageDirs files和输出文件所在的目录
+func packageDirs(files []string, outputFile string) []string {
+	dirs := make([]string, 0, len(files)+1)
+	for _, file := range files {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	return append(dirs, filepath.Dir(outputFile))
+}
+
+func sortedImportPaths(importMap map[string]*importName) []string {
+	paths := make([]string, 0, len(importMap))
+	for path := range importMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (h *importHandler) packagesConfig(mode packages.LoadMode) *packages.Config {
+	config := h.buildEnv.packagesConfig(mode)
+	config.Context = h.ctx
+	config.Dir = h.dir
+	return config
 }
 
 func (h *importHandler) getOutputImportPath(outPutDir string) (string, string, error) {
-	outputPkg, err := packages.Load(&packages.Config{Mode: packages.NeedName}, removeFileNameInPath(outPutDir))
+	dir := removeFileNameInPath(outPutDir)
+	if entry := h.cache.get("dir:" + dir); entry != nil {
+		return entry.ID, entry.Name, nil
+	}
+	outputPkg, err := packages.Load(h.packagesConfig(packages.NeedName|packages.NeedFiles), dir)
 	if err != nil {
-		fmt.Println("get output dir package info err")
 		return "", "", err
 	}
+	h.cache.put("dir:"+dir, outputPkg[0])
 	pkgPath := outputPkg[0].ID
 	pkgName := outputPkg[0].Name
+	// 输出目录中还没有go文件时使用目录名作为包名
 	if len(outputPkg[0].Errors) > 0 {
-		fmt.Println(fmt.Errorf("get outputpkg path err: %v", outputPkg[0].Errors))
 		pkgName, err = getDefaultPkgNameByFile(outPutDir)
 		if err != nil {
 			return "", "", fmt.Errorf("getOutputImportPath err: %v", err)
@@ -212,7 +279,13 @@ func (h *importHandler) getOutputImportPath(outPutDir string) (string, string, e
 func (h *importHandler) buildGlobalImportSpecs(importMap map[string]*importName) *ast.GenDecl {
 	importGenDecl := &ast.GenDecl{Tok: token.IMPORT}
 	importSpecs := make([]ast.Spec, 0)
-	for path, name := range importMap {
+	paths := make([]string, 0, len(importMap))
+	for path := range importMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		name := importMap[path]
 		importSpecs = append(importSpecs, &ast.ImportSpec{
 			Path: &ast.BasicLit{
 				Kind:  token.STRING,
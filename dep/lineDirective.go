@@ -0,0 +1,68 @@
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const sourceCommentPrefix = "// source:"
+
+var sourceCommentReg = regexp.MustCompile(`^// source: (\S+):(\d+) \(`)
+
+// addLineDirectives 在"// source: file:line (...)"注释后的构造函数中, 只给调用@autodig的func或构造struct的那一条语句加上//line file:line,
+// 这条语句之后立即恢复为生成文件自己的行号. panic的调用栈和这条语句的编译错误指向@autodig所在的源码, 生成的其他代码仍然指向生成文件.
+// providers用于找到每个source注释对应的func/struct名字. //line写在第一列, gofmt不会改变缩进和行号
+func addLineDirectives(content []byte, outputFile string, providers []*Provider) []byte {
+	outputRel := moduleRelPath(outputFile)
+	outputDir := filepath.Dir(filepath.FromSlash(outputRel))
+	idents := make(map[string]string, len(providers))
+	for _, provider := range providers {
+		idents[provider.RelPos] = provider.ident
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	buffer := &bytes.Buffer{}
+	outputLine := 0
+	writeLine := func(line string) {
+		buffer.WriteString(line)
+		outputLine++
+	}
+	// callReg 当前构造函数中调用源码func或构造源码struct的语句, 为nil时不在有source注释的构造函数中
+	var callReg *regexp.Regexp
+	var directive string
+	inBody := false
+	for _, line := range lines {
+		if match := sourceCommentReg.FindStringSubmatch(line); match != nil {
+			callReg, inBody = nil, false
+			if ident, ok := idents[match[1]+":"+match[2]]; ok {
+				source, err := filepath.Rel(outputDir, filepath.FromSlash(match[1]))
+				if err != nil {
+					source = match[1]
+				}
+				callReg = regexp.MustCompile(`(^|[^\w.])(\w+\.)?` + regexp.QuoteMeta(ident) + `[({]`)
+				directive = fmt.Sprintf("//line %s:%s\n", filepath.ToSlash(source), match[2])
+			}
+			writeLine(line)
+			continue
+		}
+		switch {
+		case callReg == nil:
+		case !inBody:
+			// 签名可能有多行, 以不缩进的"{"结尾的行为函数体的开始
+			inBody = !strings.HasPrefix(line, "\t") && strings.HasSuffix(line, "{\n")
+		case line == "}\n":
+			callReg = nil
+		case callReg.MatchString(line):
+			writeLine(directive)
+			writeLine(line)
+			// //line指定的是下一行的行号, 按最终输出计算
+			writeLine(fmt.Sprintf("//line %s:%d\n", filepath.Base(outputFile), outputLine+2))
+			callReg = nil
+			continue
+		}
+		writeLine(line)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,75 @@
+package dep
+
+import (
+	"context"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineDirectivesCompileError(t *testing.T) {
+	root := newTestModule(t, map[string]string{
+		"app/a/a.go": `package a
+
+type Client struct{}
+
+// @autodig
+type Service struct {
+	Client *Client
+}
+
+// hidden 未导出, 生成代码无法调用
+// @autodig
+func hidden() *Client {
+	return &Client{}
+}
+`,
+		"app/entrypoint/main.go": "package entrypoint\n",
+	})
+	outputFile := filepath.Join(root, "app", "entrypoint", "autodig.go")
+	a := NewAutodig([]string{filepath.Join(root, "app")}, outputFile, "").SetLineDirectives(true)
+	files, _, err := a.Generate(context.Background())
+	if err != nil {
+		t.Fatalf("Generate() err: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Generate() files = %d, want 1", len(files))
+	}
+	if formatted, err := format.Source(files[0].Content); err != nil || string(formatted) != string(files[0].Content) {
+		t.Errorf("generated file is not gofmt-stable, err: %v", err)
+	}
+	if n := strings.Count(string(files[0].Content), "//line ../a/a.go:"); n != 2 {
+		t.Errorf("got %d //line directives to a.go, want 2:\n%s", n, files[0].Content)
+	}
+	if err := ioutil.WriteFile(files[0].Path, files[0].Content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "build", "./...")
+	cmd.Dir = root
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("go build succeeded, want an error for the unexported provider")
+	}
+	var hiddenLine int
+	for _, provider := range a.providers {
+		if provider.ident == "hidden" {
+			hiddenLine = provider.Pos.Line
+		}
+	}
+	// 错误指向@autodig所在的源码, 生成代码中其他语句的错误才会指向autodig.go
+	want := fmt.Sprintf("app/a/a.go:%d", hiddenLine)
+	errLines := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			errLines = append(errLines, line)
+		}
+	}
+	if len(errLines) != 1 || !strings.HasPrefix(errLines[0], want) || !strings.Contains(errLines[0], "hidden") {
+		t.Errorf("go build output =\n%s\nwant one error at %s about hidden", out, want)
+	}
+}
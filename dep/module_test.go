@@ -0,0 +1,37 @@
+package dep
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// newTestModule 在临时目录中创建module example.com/x并写入files, 通过replace使用当前的autodig, 返回module根目录
+func newTestModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile(filepath.Join(repo, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := map[string]string{
+		"go.mod": fmt.Sprintf("module example.com/x\n\ngo 1.13\n\nrequire github.com/cindyoshinee/autodig v0.0.0\n\nreplace github.com/cindyoshinee/autodig => %s\n", repo),
+		"go.sum": string(sum),
+	}
+	for name, content := range files {
+		all[name] = content
+	}
+	writeFiles(t, root, all)
+	// 缺少的require从autodig的go.mod补全, 不访问网络
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	return root
+}
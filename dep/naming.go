@@ -0,0 +1,81 @@
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"text/template"
+)
+
+const (
+	// DefaultStructNaming struct生成的构造函数名
+	DefaultStructNaming = "New{{.Pkg}}{{.Name}}"
+	// DefaultFuncNaming func生成的包装函数名
+	DefaultFuncNaming = "{{.Pkg}}_{{.Name}}"
+)
+
+// Naming 生成函数的命名模板(text/template), 可以使用{{.Pkg}}(包在生成文件中的import别名)和{{.Name}}(struct或func的名字)
+type Naming struct {
+	Struct string `yaml:"struct" json:"struct"`
+	Func   string `yaml:"func" json:"func"`
+}
+
+type namingData struct {
+	Pkg  string
+	Name string
+}
+
+type namer struct {
+	structTmpl *template.Template
+	funcTmpl   *template.Template
+}
+
+func newNamer(naming Naming) (*namer, error) {
+	structTmpl, err := parseNamingTemplate("struct", naming.Struct, DefaultStructNaming)
+	if err != nil {
+		return nil, err
+	}
+	funcTmpl, err := parseNamingTemplate("func", naming.Func, DefaultFuncNaming)
+	if err != nil {
+		return nil, err
+	}
+	return &namer{structTmpl: structTmpl, funcTmpl: funcTmpl}, nil
+}
+
+func parseNamingTemplate(name, text, defaultText string) (*template.Template, error) {
+	if text == "" {
+		text = defaultText
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s naming template err: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// Validate 检查模板能否解析
+func (n Naming) Validate() error {
+	_, err := newNamer(n)
+	return err
+}
+
+func (n *namer) structFuncName(pkg, name string) (string, error) {
+	return execNamingTemplate(n.structTmpl, pkg, name)
+}
+
+func (n *namer) funcWrapperName(pkg, name string) (string, error) {
+	return execNamingTemplate(n.funcTmpl, pkg, name)
+}
+
+func execNamingTemplate(tmpl *template.Template, pkg, name string) (string, error) {
+	buffer := &bytes.Buffer{}
+	err := tmpl.Execute(buffer, namingData{Pkg: pkg, Name: name})
+	if err != nil {
+		return "", fmt.Errorf("execute %s naming template err: %v", tmpl.Name(), err)
+	}
+	result := buffer.String()
+	if !token.IsIdentifier(result) {
+		return "", fmt.Errorf("%s naming template generates %q for %s.%s, which is not a valid identifier", tmpl.Name(), result, pkg, name)
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// PackageOutputFileName package模式下每个包中生成的文件名
+	PackageOutputFileName = "autodig_gen.go"
+	registerFuncName      = "Register"
+	depMustRegisterMethod = "MustRegister"
+)
+
+// generatePackages 每个包含@autodig的包生成autodig_gen.go, 其中的Register(c *dig.Container) error注册本包的构造函数,
+// 构造函数和被注入的类型在同一个包中, 所以可以使用未导出的类型. 输出文件只负责在init中调用所有包的Register
+func (a *Autodig) generatePackages(files []string) ([]*genFile, error) {
+	dirFiles := make(map[string][]string)
+	dirs := make([]string, 0)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if _, ok := dirFiles[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		dirFiles[dir] = append(dirFiles[dir], file)
+	}
+	sort.Strings(dirs)
+	// 每个包在worker中独立生成, 按目录顺序合并结果
+	results := make([]*packageResult, len(dirs))
+	parallel(len(dirs), func(i int) {
+		result := &packageResult{diags: NewDiagnostics(a.maxErrors)}
+		result.file, result.providers, result.err = a.generateFile(dirFiles[dirs[i]], filepath.Join(dirs[i], PackageOutputFileName), true, result.diags)
+		results[i] = result
+	})
+	genFiles := make([]*genFile, 0)
+	registerFiles := make([]string, 0)
+	for i, result := range results {
+		if a.diags.Full() {
+			break
+		}
+		a.diags.merge(result.diags)
+		a.providers = append(a.providers, result.providers...)
+		if result.err != nil {
+			// 错误已经记录到diags中, 继续处理其他包
+			if result.diags.HasErrors() {
+				continue
+			}
+			return nil, result.err
+		}
+		if len(result.providers) == 0 {
+			continue
+		}
+		genFiles = append(genFiles, result.file)
+		registerFiles = append(registerFiles, dirFiles[dirs[i]][0])
+	}
+	if err := a.diags.Err(); err != nil {
+		return nil, fmt.Errorf("buildDecls err: %v ", err)
+	}
+	aggregator, err := a.generateAggregator(registerFiles)
+	if err != nil {
+		return nil, err
+	}
+	return append(genFiles, aggregator), nil
+}
+
+type packageResult struct {
+	file      *genFile
+	providers []*Provider
+	diags     *Diagnostics
+	err       error
+}
+
+// generateAggregator 生成输出文件: func init() { dep.MustRegister(pkga.Register, pkgb.Register) }
+// registerFiles为每个生成了Register的包中的任意一个文件
+func (a *Autodig) generateAggregator(registerFiles []string) (*genFile, error) {
+	importCtx, err := a.importHandler.GetAllImports(registerFiles, a.outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("getAllImports err: %v ", err)
+	}
+	registers := make([]ast.Expr, 0, len(registerFiles))
+	for _, file := range registerFiles {
+		if importCtx.getGlobalImportPathByFile(file) == importCtx.outputImportPath {
+			registers = append(registers, &ast.Ident{Name: registerFuncName})
+			continue
+		}
+		registers = append(registers, &ast.SelectorExpr{
+			X:   &ast.Ident{Name: importCtx.getGlobalImportNameByFile(file)},
+			Sel: &ast.Ident{Name: registerFuncName},
+		})
+	}
+	initFunc := &ast.FuncDecl{
+		Name: &ast.Ident{Name: "init"},
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X:   &ast.Ident{Name: importCtx.runtimeName()},
+				Sel: &ast.Ident{Name: depMustRegisterMethod},
+			},
+			Args: registers,
+		}}}},
+	}
+	dirs := make([]string, 0, len(registerFiles))
+	for _, file := range registerFiles {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	inputHash := a.hashPackages(dirs, a.outputDir)
+	buffer := &bytes.Buffer{}
+	err = a.write(buffer, &fileHeader{pkgName: importCtx.outputPkgName, version: Version, inputHash: inputHash}, []ast.Decl{importCtx.globalImportDecl, initFunc})
+	if err != nil {
+		return nil, err
+	}
+	return &genFile{path: a.outputDir, content: buffer.Bytes()}, nil
+}
+
+// splitPackageGenFiles 从扫描到的文件中去掉package模式生成的文件
+func splitPackageGenFiles(files []string) (sources []string, genFiles []string) {
+	for _, file := range files {
+		if filepath.Base(file) == PackageOutputFileName {
+			genFiles = append(genFiles, file)
+		} else {
+			sources = append(sources, file)
+		}
+	}
+	return sources, genFiles
+}
+
+func containsGenFile(genFiles []*genFile, path string) bool {
+	for _, each := range genFiles {
+		if each.path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package dep
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const crossPkgA = `package a
+
+type Client struct{}
+
+// @autodig
+func NewClient() *Client {
+	return &Client{}
+}
+
+// @autodig name:x
+func NewNamed() *Client {
+	return &Client{}
+}
+
+// @autodig
+type Service struct {
+	Client *Client
+}
+`
+
+func TestPackageModeCrossPackageTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       string
+		wantErr string
+		// wantUnused 没有被依赖的provider
+		wantUnused   []string
+		wantMissings int
+	}{
+		{
+			name: "duplicate provider in another package",
+			b: `package b
+
+import "example.com/x/app/a"
+
+// @autodig
+func NewOther() *a.Client {
+	return &a.Client{}
+}
+`,
+			wantErr: "*a.Client is provided by both a.NewClient",
+		},
+		{
+			name: "dependencies on another package",
+			b: `package b
+
+import "example.com/x/app/a"
+
+// @autodig
+type User struct {
+	Service *a.Service
+	Named   *a.Client ` + "`autodig:\"name:x\"`" + `
+}
+`,
+			wantUnused: []string{"b.User"},
+		},
+		{
+			name: "missing name in another package",
+			b: `package b
+
+import "example.com/x/app/a"
+
+// @autodig
+type User struct {
+	Service *a.Service
+	Named   *a.Client ` + "`autodig:\"name:y\"`" + `
+}
+`,
+			wantUnused:   []string{"a.NewNamed", "b.User"},
+			wantMissings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTestModule(t, map[string]string{
+				"app/a/a.go":             crossPkgA,
+				"app/b/b.go":             tt.b,
+				"app/entrypoint/main.go": "package entrypoint\n",
+			})
+			a := NewAutodig([]string{filepath.Join(root, "app")}, filepath.Join(root, "app", "entrypoint", "autodig.go"), "").
+				SetMode(OutputModePackage)
+			_, _, err := a.Generate(context.Background())
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("Generate() err = nil, want %q", tt.wantErr)
+				}
+				list := a.Diagnostics().List()
+				if len(list) != 1 || !strings.Contains(list[0].Msg, tt.wantErr) {
+					t.Errorf("diagnostics = %v, want one containing %q", list, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() err: %v", err)
+			}
+			report := a.Report()
+			unused := make([]string, 0)
+			for _, provider := range report.UnusedProviders {
+				unused = append(unused, provider.Symbol)
+			}
+			if strings.Join(unused, ",") != strings.Join(tt.wantUnused, ",") {
+				t.Errorf("unused providers = %v, want %v", unused, tt.wantUnused)
+			}
+			if len(report.MissingNames) != tt.wantMissings {
+				t.Errorf("missing names = %v, want %d", report.MissingNames, tt.wantMissings)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package dep
 
 import (
+	"fmt"
 	"go/ast"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -16,22 +19,37 @@ const (
 )
 
 var (
-	tagReg        = regexp.MustCompile(`autodig:"(.+)"`)
 	docReg        = regexp.MustCompile(`@autodig (.*)`)
 	initFieldInfo = &fieldInfo{ignore: false, isReturn: false, inGroup: ""}
 )
 
+var (
+	commentKeys = []string{OutGroupName, TagName, Name}
+	fieldKeys   = []string{InGroupName, Name, IgnoreName}
+)
+
 type fieldInfo struct {
 	ignore   bool
 	isReturn bool
 	inGroup  string
 	name     string
+	problems []*annotationProblem
 }
 
 type comment struct {
 	outGroup string
 	tag      string
 	name     string
+	problems []*annotationProblem
+}
+
+// annotationProblem 注释或tag中无法识别的内容
+type annotationProblem struct {
+	key string
+	// offset key在注释/tag原文中的偏移, -1表示未知
+	offset     int
+	msg        string
+	suggestion string
 }
 
 func parseFieldInfo(field *ast.Field) *fieldInfo {
@@ -42,24 +60,29 @@ func parseFieldInfo(field *ast.Field) *fieldInfo {
 	if field.Tag == nil || !strings.Contains(field.Tag.Value, "autodig") {
 		return ret
 	}
-	tagValues := tagReg.FindAllStringSubmatch(field.Tag.Value, -1)
-	if len(tagValues) != 1 || len(tagValues[0]) != 2 {
+	value, offset, ok := lookupAutodigTag(field.Tag.Value)
+	if !ok {
 		return ret
 	}
-	tags := strings.Split(tagValues[0][1], ",")
-	for _, eachTag := range tags {
-		params := strings.Split(eachTag, ":")
+	for _, eachTag := range splitWithOffset(value, ",", offset) {
+		params := strings.Split(eachTag.text, ":")
 		switch params[0] {
 		case InGroupName:
-			if len(params) == 2 {
+			if len(params) == 2 && params[1] != "" {
 				ret.inGroup = params[1]
+			} else {
+				ret.problems = append(ret.problems, missingValue(params[0], eachTag.offset))
 			}
 		case IgnoreName:
 			ret.ignore = true
 		case Name:
-			if len(params) == 2 {
+			if len(params) == 2 && params[1] != "" {
 				ret.name = params[1]
+			} else {
+				ret.problems = append(ret.problems, missingValue(params[0], eachTag.offset))
 			}
+		default:
+			ret.problems = append(ret.problems, unknownKey(params[0], eachTag.offset, fieldKeys))
 		}
 	}
 	return ret
@@ -70,27 +93,118 @@ func parseComment(doc string) *comment {
 	if !strings.Contains(doc, "@autodig") {
 		return nil
 	}
-	tagValues := docReg.FindAllStringSubmatch(doc, -1)
+	tagValues := docReg.FindStringSubmatchIndex(doc)
 	if tagValues == nil {
 		return funDoc
 	}
-	tags := strings.Split(tagValues[0][1], " ")
-	for _, eachTag := range tags {
-		params := strings.Split(eachTag, ":")
+	for _, eachTag := range splitWithOffset(strings.TrimSuffix(doc[tagValues[2]:tagValues[3]], "*/"), " ", tagValues[2]) {
+		params := strings.Split(eachTag.text, ":")
 		switch params[0] {
 		case OutGroupName:
-			if len(params) == 2 {
+			if len(params) == 2 && params[1] != "" {
 				funDoc.outGroup = params[1]
+			} else {
+				funDoc.problems = append(funDoc.problems, missingValue(params[0], eachTag.offset))
 			}
 		case TagName:
-			if len(params) == 2 {
+			if len(params) == 2 && params[1] != "" {
 				funDoc.tag = params[1]
+			} else {
+				funDoc.problems = append(funDoc.problems, missingValue(params[0], eachTag.offset))
 			}
 		case Name:
-			if len(params) == 2 {
+			if len(params) == 2 && params[1] != "" {
 				funDoc.name = params[1]
+			} else {
+				funDoc.problems = append(funDoc.problems, missingValue(params[0], eachTag.offset))
 			}
+		default:
+			funDoc.problems = append(funDoc.problems, unknownKey(params[0], eachTag.offset, commentKeys))
 		}
 	}
 	return funDoc
 }
+
+// lookupAutodigTag 返回autodig tag的值以及值在tag原文中的偏移, 偏移未知时为-1
+func lookupAutodigTag(rawTag string) (string, int, bool) {
+	unquoted, err := strconv.Unquote(rawTag)
+	if err != nil {
+		return "", -1, false
+	}
+	value, ok := reflect.StructTag(unquoted).Lookup("autodig")
+	if !ok || value == "" {
+		return "", -1, false
+	}
+	offset := -1
+	if rawTag[0] == '`' {
+		if index := strings.Index(rawTag, `autodig:"`+value+`"`); index >= 0 {
+			offset = index + len(`autodig:"`)
+		}
+	}
+	return value, offset, true
+}
+
+type textWithOffset struct {
+	text   string
+	offset int
+}
+
+// splitWithOffset 按sep切分并忽略空项，offset为s在原文中的偏移
+func splitWithOffset(s string, sep string, offset int) []textWithOffset {
+	ret := make([]textWithOffset, 0)
+	cur := 0
+	for _, each := range strings.Split(s, sep) {
+		if strings.TrimSpace(each) != "" {
+			eachOffset := -1
+			if offset >= 0 {
+				eachOffset = offset + cur
+			}
+			ret = append(ret, textWithOffset{text: strings.TrimSpace(each), offset: eachOffset})
+		}
+		cur += len(each) + len(sep)
+	}
+	return ret
+}
+
+func missingValue(key string, offset int) *annotationProblem {
+	return &annotationProblem{key: key, offset: offset, msg: fmt.Sprintf("%q requires a value, e.g. %s:xxx", key, key)}
+}
+
+func unknownKey(key string, offset int, known []string) *annotationProblem {
+	problem := &annotationProblem{key: key, offset: offset, msg: fmt.Sprintf("unknown key %q", key)}
+	for _, each := range known {
+		if each != IgnoreName && editDistance(key, each) <= 2 {
+			problem.suggestion = each
+			problem.msg = fmt.Sprintf("unknown key %q, did you mean %q?", key, each)
+			break
+		}
+	}
+	return problem
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,193 @@
+package dep
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// sourceSet 每个输入文件只解析一次, import处理和生成声明共用同一个FileSet和AST.
+// AST中只有package、import和与生成有关的声明, 见parseFile.
+// AST是只读的, 需要修改的decl先通过cloneDecl拷贝. 可以被多个goroutine同时使用
+type sourceSet struct {
+	fset  *token.FileSet
+	mu    sync.Mutex
+	files map[string]*parsedFile
+	// cache 按文件内容的hash缓存与生成有关的声明的位置, 为nil时每次完整解析
+	cache *loadCache
+}
+
+type parsedFile struct {
+	ast  *ast.File
+	err  error
+	once sync.Once
+}
+
+func newSourceSet(cache *loadCache) *sourceSet {
+	return &sourceSet{fset: token.NewFileSet(), files: make(map[string]*parsedFile), cache: cache}
+}
+
+// parse 并行解析还没有解析过的文件, 返回的结果与files顺序一致
+func (s *sourceSet) parse(files []string) []*parsedFile {
+	ret := make([]*parsedFile, len(files))
+	s.mu.Lock()
+	for i, file := range files {
+		if _, ok := s.files[file]; !ok {
+			s.files[file] = &parsedFile{}
+		}
+		ret[i] = s.files[file]
+	}
+	s.mu.Unlock()
+	parallel(len(files), func(i int) {
+		ret[i].once.Do(func() {
+			ret[i].ast, ret[i].err = s.parseFile(files[i])
+		})
+	})
+	return ret
+}
+
+func (s *sourceSet) get(file string) *parsedFile {
+	return s.parse([]string{file})[0]
+}
+
+// parseFile 只解析package、import、有@autodig的声明和Init方法, 其余内容替换为空格, 位置信息与源文件相同.
+// 这些声明的位置按文件内容的hash缓存, 文件没有变化时不再完整解析
+func (s *sourceSet) parseFile(file string) (*ast.File, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256(content))
+	keep := s.cache.getFile(file, hash, len(content))
+	if keep == nil {
+		fset := token.NewFileSet()
+		full, err := parser.ParseFile(fset, file, content, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		keep = relevantRanges(fset, full, content)
+		s.cache.putFile(file, &cachedFile{Hash: hash, Keep: keep})
+	}
+	return parser.ParseFile(s.fset, file, blankExcept(content, keep), parser.ParseComments)
+}
+
+// relevantRanges 与生成有关的内容在文件中的[start, end)偏移, 声明包括doc注释
+func relevantRanges(fset *token.FileSet, fileAST *ast.File, content []byte) [][2]int {
+	tokenFile := fset.File(fileAST.Pos())
+	span := func(from token.Pos, to token.Pos) [2]int {
+		return [2]int{tokenFile.Offset(from), tokenFile.Offset(to)}
+	}
+	keep := [][2]int{span(fileAST.Package, fileAST.Name.End())}
+	for _, decl := range fileAST.Decls {
+		from := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			from = doc.Pos()
+		}
+		declRange := span(from, decl.End())
+		relevant := bytes.Contains(content[declRange[0]:declRange[1]], []byte("@autodig"))
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			relevant = relevant || decl.Tok == token.IMPORT
+		case *ast.FuncDecl:
+			relevant = relevant || decl.Recv != nil && decl.Name.Name == "Init"
+		}
+		if relevant {
+			keep = append(keep, declRange)
+		}
+	}
+	return keep
+}
+
+// blankExcept 把keep以外的内容替换为空格, 保留换行
+func blankExcept(content []byte, keep [][2]int) []byte {
+	ret := make([]byte, len(content))
+	for i, c := range content {
+		if c == '\n' {
+			ret[i] = '\n'
+		} else {
+			ret[i] = ' '
+		}
+	}
+	for _, each := range keep {
+		copy(ret[each[0]:each[1]], content[each[0]:each[1]])
+	}
+	return ret
+}
+
+// parallel 用最多GOMAXPROCS个goroutine执行fn(0)...fn(n-1), 全部完成后返回
+func parallel(n int, fn func(i int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+	next := int64(-1)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+var (
+	astObjectType = reflect.TypeOf((*ast.Object)(nil))
+	astScopeType  = reflect.TypeOf((*ast.Scope)(nil))
+)
+
+// cloneDecl 深拷贝decl, 位置信息保持不变. *ast.Object和*ast.Scope之间有环, 不拷贝
+func cloneDecl(decl ast.Decl) ast.Decl {
+	return cloneValue(reflect.ValueOf(decl)).Interface().(ast.Decl)
+}
+
+func cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == astObjectType || v.Type() == astScopeType {
+			return v
+		}
+		ret := reflect.New(v.Type().Elem())
+		ret.Elem().Set(cloneValue(v.Elem()))
+		return ret
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		ret := reflect.New(v.Type()).Elem()
+		ret.Set(cloneValue(v.Elem()))
+		return ret
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		ret := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			ret.Index(i).Set(cloneValue(v.Index(i)))
+		}
+		return ret
+	case reflect.Struct:
+		ret := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			ret.Field(i).Set(cloneValue(v.Field(i)))
+		}
+		return ret
+	default:
+		return v
+	}
+}
@@ -0,0 +1,175 @@
+package dep
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+const cachedSource = `package svc
+
+import "fmt"
+
+// Helper 与生成无关, 只在第一次解析
+func Helper() {
+	fmt.Println("helper")
+}
+
+// @autodig
+type Service struct {
+	Name string
+}
+
+func (s *Service) Init() error {
+	return nil
+}
+
+// @autodig
+func NewName() string {
+	return "x"
+}
+`
+
+// declNames AST中的声明, import为"import", 方法为"Recv.Name"
+func declNames(fileAST *ast.File) []string {
+	names := make([]string, 0)
+	for _, decl := range fileAST.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok.String() == "import" {
+				names = append(names, "import")
+			} else {
+				names = append(names, decl.Specs[0].(*ast.TypeSpec).Name.Name)
+			}
+		case *ast.FuncDecl:
+			if decl.Recv != nil {
+				names = append(names, recvName(decl.Recv.List[0].Type)+"."+decl.Name.Name)
+			} else {
+				names = append(names, decl.Name.Name)
+			}
+		}
+	}
+	return names
+}
+
+func recvName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		return "*" + recvName(star.X)
+	}
+	return expr.(*ast.Ident).Name
+}
+
+func TestSourceSetFileCache(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "svc", "svc.go")
+	writeFiles(t, dir, map[string]string{"go.mod": "module example.com/x\n", "svc/svc.go": cachedSource})
+	outputFile := filepath.Join(dir, "autodig.go")
+	cacheDir := filepath.Join(dir, "cache")
+
+	parse := func() (*sourceSet, *loadCache) {
+		cache := openLoadCache(cacheDir, BuildEnv{}, outputFile)
+		sources := newSourceSet(cache)
+		parsed := sources.get(file)
+		if parsed.err != nil {
+			t.Fatal(parsed.err)
+		}
+		return sources, cache
+	}
+	want := []string{"import", "Service", "*Service.Init", "NewName"}
+
+	sources, cache := parse()
+	if got := declNames(sources.get(file).ast); !reflect.DeepEqual(got, want) {
+		t.Errorf("decls = %v, want %v", got, want)
+	}
+	// 位置与源文件相同
+	decl := sources.get(file).ast.Decls[1].(*ast.GenDecl)
+	if pos := sources.fset.Position(decl.Pos()); pos.Line != 11 || pos.Column != 1 {
+		t.Errorf("Service at %v, want line 11 column 1", pos)
+	}
+	cache.save()
+
+	// 内容没有变化时使用缓存的位置: 缓存中只留下package和import, 解析结果中也只有import
+	cache = openLoadCache(cacheDir, BuildEnv{}, outputFile)
+	entry := cache.files[file]
+	if entry == nil {
+		t.Fatalf("file %s is not cached", file)
+	}
+	entry.Keep = entry.Keep[:2]
+	cache.dirty = true
+	cache.save()
+	sources, _ = parse()
+	if got := declNames(sources.get(file).ast); !reflect.DeepEqual(got, []string{"import"}) {
+		t.Errorf("decls from cache = %v, want [import]", got)
+	}
+
+	// 文件修改后重新完整解析
+	if err := ioutil.WriteFile(file, []byte(cachedSource+"\n// @autodig\nfunc NewOther() int {\n\treturn 1\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sources, _ = parse()
+	if got := declNames(sources.get(file).ast); !reflect.DeepEqual(got, append(want, "NewOther")) {
+		t.Errorf("decls after edit = %v, want %v", got, append(want, "NewOther"))
+	}
+}
+
+func TestGenerateSameOutputForAnyWorkerCount(t *testing.T) {
+	files := map[string]string{"app/entrypoint/main.go": "package entrypoint\n"}
+	for i := 0; i < 12; i++ {
+		pkg := fmt.Sprintf("p%d", i)
+		next := ""
+		if i > 0 {
+			next = fmt.Sprintf("\n\tPrev *p%d.Client", i-1)
+		}
+		imports := ""
+		if i > 0 {
+			imports = fmt.Sprintf("\nimport \"example.com/x/app/p%d\"\n", i-1)
+		}
+		files["app/"+pkg+"/"+pkg+".go"] = fmt.Sprintf(`package %s
+%s
+// @autodig outgroup:clients
+type Client struct {%s
+}
+
+// @autodig name:%s
+func NewNamed() *Client {
+	return &Client{}
+}
+`, pkg, imports, next, pkg)
+	}
+	root := newTestModule(t, files)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for _, mode := range []string{OutputModeSingle, OutputModePackage} {
+		var want []*GeneratedFile
+		for _, workers := range []int{1, 2, 8} {
+			runtime.GOMAXPROCS(workers)
+			a := NewAutodig([]string{filepath.Join(root, "app")}, filepath.Join(root, "app", "entrypoint", "autodig.go"), "").SetMode(mode)
+			got, _, err := a.Generate(context.Background())
+			if err != nil {
+				t.Fatalf("mode %s, %d workers: Generate() err: %v", mode, workers, err)
+			}
+			if want == nil {
+				// package模式下每个包一个autodig_gen.go
+				if mode == OutputModePackage && len(got) != 13 {
+					t.Fatalf("mode %s: got %d files, want 13", mode, len(got))
+				}
+				want = got
+				continue
+			}
+			if len(got) != len(want) {
+				t.Fatalf("mode %s, %d workers: got %d files, want %d", mode, workers, len(got), len(want))
+			}
+			for i := range got {
+				if got[i].Path != want[i].Path || !bytes.Equal(got[i].Content, want[i].Content) {
+					t.Errorf("mode %s, %d workers: %s differs from the output with 1 worker:\n%s\nwant\n%s",
+						mode, workers, got[i].Path, got[i].Content, want[i].Content)
+				}
+			}
+		}
+	}
+}
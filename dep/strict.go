@@ -0,0 +1,68 @@
+package dep
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// annotationChecker 报告注释和tag中的问题, strict模式下为error, 否则为warning
+type annotationChecker struct {
+	fset   *token.FileSet
+	diags  *Diagnostics
+	strict bool
+}
+
+func (c *annotationChecker) report(pos token.Pos, format string, args ...interface{}) {
+	if c.strict {
+		c.diags.Errorf(c.fset.Position(pos), format, args...)
+	} else {
+		c.diags.Warnf(c.fset.Position(pos), format, args...)
+	}
+}
+
+func (c *annotationChecker) reportProblems(base token.Pos, problems []*annotationProblem) {
+	for _, problem := range problems {
+		pos := base
+		if problem.offset >= 0 {
+			pos += token.Pos(problem.offset)
+		}
+		c.report(pos, "%s", problem.msg)
+	}
+}
+
+func (c *annotationChecker) reportFieldProblems(field *ast.Field, problems []*annotationProblem) {
+	if field.Tag == nil {
+		return
+	}
+	c.reportProblems(field.Tag.Pos(), problems)
+}
+
+// checkBuiltinInjection struct字段注入string等内置类型时必须指定name, 否则很容易和其他同类型的provider冲突.
+// func的参数无法指定name, 不检查
+func (c *annotationChecker) checkBuiltinInjection(field *ast.Field, name string) {
+	if !c.strict || name != "" {
+		return
+	}
+	ident, ok := field.Type.(*ast.Ident)
+	if !ok || !containsString(basicIdentName, ident.Name) {
+		return
+	}
+	fieldName := ident.Name
+	if len(field.Names) > 0 {
+		fieldName = field.Names[0].Name
+	}
+	c.diags.Warnf(c.fset.Position(field.Pos()), "%s injects builtin type %s without name, add autodig:\"name:xxx\" to avoid conflicts", fieldName, ident.Name)
+}
+
+// findComment 返回doc中第一条@autodig注释
+func findComment(doc *ast.CommentGroup) (*ast.Comment, *comment) {
+	if doc == nil {
+		return nil, nil
+	}
+	for _, each := range doc.List {
+		if parsed := parseComment(each.Text); parsed != nil {
+			return each, parsed
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,106 @@
+package dep
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const strictSource = `package a
+
+type Client struct{}
+
+// @autodig outgrop:x
+func NewClient() *Client {
+	return &Client{}
+}
+
+type Other struct{}
+
+// @autodig color:red
+func NewOther() *Other {
+	return &Other{}
+}
+
+// @autodig
+func (c *Client) Close() {}
+
+// @autodig
+type Service struct {
+	Client *Client ` + "`autodig:\"nmae:x\"`" + `
+}
+`
+
+func TestStrictMode(t *testing.T) {
+	want := []string{
+		`a.go:5:13: unknown key "outgrop", did you mean "outgroup"?`,
+		`a.go:12:13: unknown key "color"`,
+		`a.go:17:1: @autodig is not supported on method Close, it is ignored`,
+		`a.go:22:27: unknown key "nmae", did you mean "name"?`,
+	}
+	tests := []struct {
+		strict       bool
+		wantSeverity Severity
+	}{
+		{strict: false, wantSeverity: SeverityWarning},
+		{strict: true, wantSeverity: SeverityError},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("strict=%v", tt.strict), func(t *testing.T) {
+			root := newTestModule(t, map[string]string{
+				"app/a/a.go":             strictSource,
+				"app/entrypoint/main.go": "package entrypoint\n",
+			})
+			a := NewAutodig([]string{filepath.Join(root, "app")}, filepath.Join(root, "app", "entrypoint", "autodig.go"), "").
+				SetStrict(tt.strict)
+			_, _, err := a.Generate(context.Background())
+			if (err != nil) != tt.strict {
+				t.Errorf("Generate() err = %v, want error: %v", err, tt.strict)
+			}
+			got := make([]string, 0)
+			for _, d := range a.Diagnostics().List() {
+				if d.Severity != tt.wantSeverity {
+					t.Errorf("%s: severity %s, want %s", d, d.Severity, tt.wantSeverity)
+				}
+				got = append(got, fmt.Sprintf("%s:%d:%d: %s", filepath.Base(d.Pos.Filename), d.Pos.Line, d.Pos.Column, d.Msg))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("diagnostics =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+}
+
+func TestUnknownKeySuggestion(t *testing.T) {
+	tests := []struct {
+		key   string
+		known []string
+		want  string
+	}{
+		{"outgrop", commentKeys, "outgroup"},
+		{"nmae", commentKeys, "name"},
+		{"tga", commentKeys, "tag"},
+		{"ingrop", fieldKeys, "ingroup"},
+		{"Name", fieldKeys, "name"},
+		// 差别太大时不给出建议
+		{"color", commentKeys, ""},
+		{"group", commentKeys, ""},
+		// "-"不作为建议
+		{"x", fieldKeys, ""},
+	}
+	for _, tt := range tests {
+		problem := unknownKey(tt.key, 0, tt.known)
+		if problem.suggestion != tt.want {
+			t.Errorf("unknownKey(%q) suggestion = %q, want %q", tt.key, problem.suggestion, tt.want)
+		}
+		wantMsg := fmt.Sprintf("unknown key %q", tt.key)
+		if tt.want != "" {
+			wantMsg += fmt.Sprintf(", did you mean %q?", tt.want)
+		}
+		if problem.msg != wantMsg {
+			t.Errorf("unknownKey(%q) msg = %q, want %q", tt.key, problem.msg, wantMsg)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// TestOutputFileName 测试中使用的provider生成到输出目录下的这个文件中
+	TestOutputFileName = "autodig_test.go"
+	depOverrideMethod  = "Override"
+	autodigHeaderText  = "// Code generated by autodig. DO NOT EDIT."
+)
+
+func (a *Autodig) testOutputFile() string {
+	return filepath.Join(filepath.Dir(a.outputDir), TestOutputFileName)
+}
+
+// generateTestFile 输出包中_test.go文件里的@autodig生成到autodig_test.go, 只在测试时编译.
+// 与生产代码中的provider提供相同类型(和name)时, 通过dep.Override在测试中替换生产代码的provider.
+// _test.go中的声明只能被同一个包的测试使用, 其他包测试文件中的@autodig只报告warning.
+// 没有测试provider时返回nil
+func (a *Autodig) generateTestFile(testFiles []string, files []string) (*genFile, error) {
+	outputFile := a.testOutputFile()
+	sources, err := a.selectTestFiles(testFiles, filepath.Dir(outputFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	if exist, err := os.Stat(outputFile); err == nil && !exist.IsDir() {
+		generated, err := isAutodigFile(outputFile)
+		if err != nil {
+			return nil, err
+		}
+		if !generated {
+			return nil, fmt.Errorf("%s exists and is not generated by autodig, rename it so the test providers can be generated", outputFile)
+		}
+	}
+	inputHash := a.hashInputs(append(append([]string{}, sources...), files...), outputFile)
+	importCtx, err := a.importHandler.GetAllImports(sources, outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("getAllImports err: %v ", err)
+	}
+	fileBuilder := NewFileBuilder(importCtx, a.diags, BuildOptions{Strict: a.strict, Naming: a.naming})
+	decls, err := fileBuilder.BuildDecls(sources, importCtx, a.cmdTag)
+	if err != nil {
+		return nil, fmt.Errorf("buildDecls err: %v ", err)
+	}
+	testProviders := fileBuilder.Providers()
+	if len(testProviders) == 0 {
+		return nil, nil
+	}
+	checkDuplicateProviders(testProviders, a.diags)
+	if overrides := overriddenProviders(a.providers, testProviders); len(overrides) > 0 {
+		// 放在init之前
+		initFunc := decls[len(decls)-1]
+		decls = append(decls[:len(decls)-1], buildOverrideDecl(importCtx.runtimeName(), overrides), initFunc)
+	}
+	buffer := &bytes.Buffer{}
+	err = a.write(buffer, &fileHeader{pkgName: importCtx.outputPkgName, version: Version, inputHash: inputHash}, decls)
+	if err != nil {
+		return nil, err
+	}
+	return a.newGenFile(outputFile, buffer.Bytes(), testProviders), nil
+}
+
+// selectTestFiles 返回输出目录中属于输出包(不是_test外部测试包)的测试文件
+func (a *Autodig) selectTestFiles(testFiles []string, outputDir string) ([]string, error) {
+	sources := make([]string, 0)
+	fset := a.sources.fset
+	for _, file := range testFiles {
+		if file == a.testOutputFile() {
+			continue
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Contains(content, []byte("@autodig")) {
+			continue
+		}
+		parsed := a.sources.get(file)
+		if parsed.err != nil {
+			a.diags.AddError(fset, token.NoPos, parsed.err)
+			continue
+		}
+		fileAST := parsed.ast
+		if filepath.Dir(file) == outputDir && !strings.HasSuffix(fileAST.Name.Name, "_test") {
+			sources = append(sources, file)
+			continue
+		}
+		for _, decl := range fileAST.Decls {
+			if doc := declDoc(decl); doc != nil {
+				if commentNode, _ := findComment(doc); commentNode != nil {
+					a.diags.Warnf(fset.Position(commentNode.Pos()), "@autodig in %s is ignored, only test files of the output package %s are generated into %s",
+						filepath.Base(file), outputDir, TestOutputFileName)
+				}
+			}
+		}
+	}
+	return sources, nil
+}
+
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch decl := decl.(type) {
+	case *ast.GenDecl:
+		return decl.Doc
+	case *ast.FuncDecl:
+		return decl.Doc
+	}
+	return nil
+}
+
+// overriddenProviders 与测试provider提供相同类型和name的非group生产provider
+func overriddenProviders(providers []*Provider, testProviders []*Provider) []*Provider {
+	testKeys := make(map[string]bool)
+	for _, provider := range testProviders {
+		if provider.Group != "" {
+			continue
+		}
+		for i := range provider.Provides {
+			testKeys[provider.Name+":"+provider.typeKey(i)] = true
+		}
+	}
+	overrides := make([]*Provider, 0)
+	for _, provider := range providers {
+		if provider.Group != "" {
+			continue
+		}
+		for i := range provider.Provides {
+			if testKeys[provider.Name+":"+provider.typeKey(i)] {
+				overrides = append(overrides, provider)
+				break
+			}
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].RelPos < overrides[j].RelPos
+	})
+	return overrides
+}
+
+// buildOverrideDecl var _ = dep.Override(dep.Source{...}, ...)
+func buildOverrideDecl(runtimeName string, overrides []*Provider) ast.Decl {
+	args := make([]ast.Expr, 0, len(overrides))
+	for _, provider := range overrides {
+		args = append(args, newSourceExpr(runtimeName, provider))
+	}
+	return &ast.GenDecl{
+		Tok: token.VAR,
+		Specs: []ast.Spec{&ast.ValueSpec{
+			Names: []*ast.Ident{{Name: "_"}},
+			Values: []ast.Expr{&ast.CallExpr{
+				Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: runtimeName}, Sel: &ast.Ident{Name: depOverrideMethod}},
+				Args: args,
+			}},
+		}},
+	}
+}
+
+// isAutodigFile file由autodig生成, 不存在时返回false
+func isAutodigFile(file string) (bool, error) {
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.HasPrefix(content, []byte(autodigHeaderText)), nil
+}
@@ -0,0 +1,90 @@
+package dep
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateTestFileOverride(t *testing.T) {
+	root := newTestModule(t, map[string]string{
+		"app/a/a.go": `package a
+
+type Client struct {
+	Fake bool
+}
+
+// @autodig
+func NewClient() *Client {
+	return &Client{}
+}
+
+// @autodig
+type Service struct {
+	Client *Client
+}
+`,
+		"app/entrypoint/main.go": "package entrypoint\n",
+		"app/entrypoint/fake_test.go": `package entrypoint
+
+import "example.com/x/app/a"
+
+// @autodig
+func newFakeClient() *a.Client {
+	return &a.Client{Fake: true}
+}
+`,
+		"app/entrypoint/main_test.go": `package entrypoint
+
+import (
+	"testing"
+
+	"example.com/x/app/a"
+	"github.com/cindyoshinee/autodig/dep"
+)
+
+func TestServiceUsesFake(t *testing.T) {
+	if err := dep.Container.Invoke(func(service *a.Service) {
+		if !service.Client.Fake {
+			t.Errorf("service.Client is the production client, want the fake")
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+`,
+	})
+	a := NewAutodig([]string{filepath.Join(root, "app")}, filepath.Join(root, "app", "entrypoint", "autodig.go"), "")
+	files, _, err := a.Generate(context.Background())
+	if err != nil {
+		t.Fatalf("Generate() err: %v", err)
+	}
+	var testFile *GeneratedFile
+	for _, file := range files {
+		if filepath.Base(file.Path) == TestOutputFileName {
+			testFile = file
+		}
+		if err := ioutil.WriteFile(file.Path, file.Content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if testFile == nil {
+		t.Fatalf("Generate() files = %d, want %s", len(files), TestOutputFileName)
+	}
+	// 只替换提供相同类型的a.NewClient
+	if n := bytes.Count(testFile.Content, []byte("dep.Override(")); n != 1 || !bytes.Contains(testFile.Content, []byte(`Symbol: "a.NewClient"`)) {
+		t.Errorf("%s should override a.NewClient only:\n%s", TestOutputFileName, testFile.Content)
+	}
+	if bytes.Contains(testFile.Content, []byte(`Symbol: "a.Service"`)) {
+		t.Errorf("%s should not override a.Service:\n%s", TestOutputFileName, testFile.Content)
+	}
+
+	cmd := exec.Command("go", "test", "./app/entrypoint")
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go test err: %v\n%s", err, out)
+	}
+}
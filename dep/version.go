@@ -0,0 +1,4 @@
+package dep
+
+// Version autodig版本号, 会写入生成文件的header中
+const Version = "v0.2.0"
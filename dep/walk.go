@@ -0,0 +1,206 @@
+package dep
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultExcludeDirs 扫描时默认跳过的目录. 此外以"."或"_"开头的目录、包含go.mod的子模块也会被跳过
+var DefaultExcludeDirs = []string{"vendor", "testdata"}
+
+// generatedReg 见https://golang.org/s/generatedcode
+var generatedReg = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// getAllFiles 返回扫描目录中的源码文件和_test.go文件
+func (a *Autodig) getAllFiles(dirs []string) (files []string, testFiles []string, err error) {
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		eachDirFiles, err := a.getFilesInOneDir(dir, dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("getAllFiles err :%v", err)
+		}
+		// 扫描目录之间有重叠时只保留一份
+		for _, file := range eachDirFiles {
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+			if strings.HasSuffix(file, "_test.go") {
+				testFiles = append(testFiles, file)
+			} else {
+				files = append(files, file)
+			}
+		}
+	}
+	return files, testFiles, nil
+}
+
+func (a *Autodig) getFilesInOneDir(root, dirPath string) (files []string, err error) {
+	dir, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	pthSep := string(os.PathSeparator)
+	for _, fi := range dir {
+		fileName := fmt.Sprintf("%s%s%s", dirPath, pthSep, fi.Name())
+		rel := relSlashPath(root, fileName)
+		if matchAny(a.excludes, rel) {
+			continue
+		}
+		if fi.IsDir() {
+			if skipDir(fileName) {
+				continue
+			}
+			// go generate ./...时有自己的//go:generate autodig的子目录由自己的指令生成, 否则同一个provider会被注册两次
+			if a.goGenerate && fileName != filepath.Dir(a.outputDir) {
+				pos, owned, err := findGenerateDirective(fileName)
+				if err != nil {
+					return nil, err
+				}
+				if owned {
+					a.diags.Warnf(pos, "skip %s, its providers are generated by this //go:generate autodig directive", relSlashPath(root, fileName))
+					continue
+				}
+			}
+			eachFiles, err := a.getFilesInOneDir(root, fileName)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, eachFiles...)
+			continue
+		}
+		if !strings.HasSuffix(fi.Name(), ".go") {
+			continue
+		}
+		ok, err := a.buildEnv.matchFile(dirPath, fi.Name())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		// 按包生成的文件由splitPackageGenFiles处理, 其他生成的文件需要通过include显式扫描
+		if fi.Name() != PackageOutputFileName && !matchAny(a.includes, rel) {
+			generated, err := isGeneratedFile(fileName)
+			if err != nil {
+				return nil, err
+			}
+			if generated {
+				continue
+			}
+		}
+		files = append(files, fileName)
+	}
+	return
+}
+
+// skipDir 默认跳过的目录: vendor、testdata、隐藏目录、go工具忽略的"_"开头的目录和嵌套的module
+func skipDir(dir string) bool {
+	name := filepath.Base(dir)
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || containsString(DefaultExcludeDirs, name) {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil
+}
+
+// generateDirectiveReg //go:generate autodig、//go:generate /path/to/autodig或//go:generate go run github.com/cindyoshinee/autodig@version
+var generateDirectiveReg = regexp.MustCompile(`(?m)^//go:generate\s+(?:go\s+run\s+)?(?:\S*/)?autodig(?:@\S+)?(?:\s|$)`)
+
+// findGenerateDirective 返回dir下的go文件中第一个调用autodig的//go:generate的位置
+func findGenerateDirective(dir string) (token.Position, bool, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return token.Position{}, false, err
+	}
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") {
+			continue
+		}
+		file := filepath.Join(dir, info.Name())
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return token.Position{}, false, err
+		}
+		if loc := generateDirectiveReg.FindIndex(content); loc != nil {
+			line := bytes.Count(content[:loc[0]], []byte("\n")) + 1
+			return token.Position{Filename: file, Line: line, Column: 1}, true, nil
+		}
+	}
+	return token.Position{}, false, nil
+}
+
+// isGeneratedFile package声明之前有"// Code generated ... DO NOT EDIT."注释的文件
+func isGeneratedFile(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if generatedReg.MatchString(line) {
+			return true, nil
+		}
+		if strings.HasPrefix(line, "package ") {
+			return false, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func relSlashPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// matchAny path为相对扫描目录的"/"分隔路径. 不含"/"的pattern匹配任意一级的名字,
+// 其他pattern匹配整个路径, "**"匹配任意多级目录, 如internal/legacy/**
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := filepath.Match(pattern, path[strings.LastIndex(path, "/")+1:]); ok {
+				return true
+			}
+			continue
+		}
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(path, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// "**"匹配0到len(path)级
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
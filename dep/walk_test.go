@@ -0,0 +1,177 @@
+package dep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"internal/legacy/**", "internal/legacy", true},
+		{"internal/legacy/**", "internal/legacy/a.go", true},
+		{"internal/legacy/**", "internal/legacy/x/y/a.go", true},
+		{"internal/legacy/**", "internal/legacyx/a.go", false},
+		{"internal/legacy/**", "pkg/internal/legacy/a.go", false},
+		{"**/mock", "mock", true},
+		{"**/mock", "a/b/mock", true},
+		{"**/mock", "a/b/mock/c", false},
+		{"a/**/b.go", "a/b.go", true},
+		{"a/**/b.go", "a/x/y/b.go", true},
+		{"a/**/b.go", "a/x/y/c.go", false},
+		{"a/*/b.go", "a/x/b.go", true},
+		{"a/*/b.go", "a/x/y/b.go", false},
+		{"./a/b.go", "a/b.go", true},
+		// 不含"/"的pattern匹配任意一级的名字
+		{"*_gen.go", "a/b/x_gen.go", true},
+		{"*_gen.go", "x_gen.go", true},
+		{"legacy", "internal/legacy", true},
+		{"legacy", "internal/legacy/a.go", false},
+		{"*.go", "a/b.txt", false},
+	}
+	for _, tt := range tests {
+		if got := matchAny([]string{tt.pattern}, tt.path); got != tt.want {
+			t.Errorf("matchAny(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+	if matchAny(nil, "a.go") {
+		t.Errorf("matchAny(nil) = true, want false")
+	}
+	if !matchAny([]string{"x/**", "*.go"}, "a/b.go") {
+		t.Errorf("matchAny should match if any pattern matches")
+	}
+}
+
+func TestGetAllFilesGenerateDirective(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.go":            "package app\n",
+		"foo/foo.go":      "package foo\n\n//go:generate autodig\n",
+		"foo/bar.go":      "package foo\n",
+		"out/gen.go":      "package out\n\n//go:generate autodig -scans ..\n",
+		"plain/plain.go":  "package plain\n\n//go:generate stringer -type X\n",
+		"vendor/v/v.go":   "package v\n",
+		"sub/go.mod":      "module sub\n",
+		"sub/sub.go":      "package sub\n",
+		"gen/gen_test.go": "package gen\n",
+	})
+	tests := []struct {
+		name       string
+		goGenerate bool
+		want       []string
+		warnings   int
+	}{
+		{
+			name: "direct run scans directive dirs",
+			want: []string{"a.go", "foo/bar.go", "foo/foo.go", "out/gen.go", "plain/plain.go"},
+		},
+		{
+			name:       "go:generate skips dirs with their own directive",
+			goGenerate: true,
+			want:       []string{"a.go", "out/gen.go", "plain/plain.go"},
+			warnings:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAutodig([]string{root}, filepath.Join(root, "out", "autodig.go"), "").SetGoGenerate(tt.goGenerate)
+			files, testFiles, err := a.getAllFiles([]string{root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(files))
+			for _, file := range files {
+				got = append(got, relSlashPath(root, file))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			if len(testFiles) != 1 {
+				t.Errorf("testFiles = %v, want gen/gen_test.go", testFiles)
+			}
+			if n := a.Diagnostics().WarningCount(); n != tt.warnings {
+				t.Errorf("got %d warnings, want %d: %v", n, tt.warnings, a.Diagnostics().List())
+			}
+		})
+	}
+}
+
+func TestGetAllFilesBuildConstraints(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.go":         "package app\n",
+		"linux.go":     "//go:build linux\n\npackage app\n",
+		"windows.go":   "//go:build windows\n\npackage app\n",
+		"a_darwin.go":  "package app\n",
+		"a_arm64.go":   "package app\n",
+		"pro.go":       "//go:build pro\n\npackage app\n",
+		"free.go":      "//go:build !pro\n\npackage app\n",
+		"old_style.go": "// +build linux,pro\n\npackage app\n",
+		"ignored.go":   "//go:build ignore\n\npackage app\n",
+	})
+	tests := []struct {
+		name string
+		env  BuildEnv
+		want []string
+	}{
+		{
+			name: "linux amd64",
+			env:  BuildEnv{GOOS: "linux", GOARCH: "amd64"},
+			want: []string{"a.go", "free.go", "linux.go"},
+		},
+		{
+			name: "darwin arm64",
+			env:  BuildEnv{GOOS: "darwin", GOARCH: "arm64"},
+			want: []string{"a.go", "a_arm64.go", "a_darwin.go", "free.go"},
+		},
+		{
+			name: "windows with tag pro",
+			env:  BuildEnv{GOOS: "windows", GOARCH: "amd64", Tags: []string{"pro"}},
+			want: []string{"a.go", "pro.go", "windows.go"},
+		},
+		{
+			name: "linux with tag pro",
+			env:  BuildEnv{GOOS: "linux", GOARCH: "amd64", Tags: []string{"pro"}},
+			want: []string{"a.go", "linux.go", "old_style.go", "pro.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAutodig([]string{root}, filepath.Join(root, "out", "autodig.go"), "").SetBuildEnv(tt.env)
+			files, _, err := a.getAllFiles([]string{root})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(files))
+			for _, file := range files {
+				got = append(got, relSlashPath(root, file))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeFiles 在dir下写入files, key为"/"分隔的相对路径
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
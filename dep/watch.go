@@ -0,0 +1,94 @@
+package dep
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WatchOptions autodig watch的轮询参数
+type WatchOptions struct {
+	// Interval 检查文件变化的间隔, 默认500ms
+	Interval time.Duration
+	// Debounce 最后一次变化之后等待的时间, 连续保存多个文件时只生成一次, 默认300ms
+	Debounce time.Duration
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch 先生成一次, 之后轮询扫描目录, .go文件新增、删除或修改后重新生成. 每次生成后调用onGenerate,
+// 生成失败不会停止watch, 错误和警告可以通过Diagnostics获取. ctx结束时返回ctx.Err()
+func (a *Autodig) Watch(ctx context.Context, opts WatchOptions, onGenerate func(err error)) error {
+	if opts.Interval <= 0 {
+		opts.Interval = 500 * time.Millisecond
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 300 * time.Millisecond
+	}
+	err := a.handleParam()
+	if err != nil {
+		return err
+	}
+	last, err := a.snapshot()
+	if err != nil {
+		return err
+	}
+	onGenerate(a.GenDigFile())
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	var changedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			current, err := a.snapshot()
+			if err != nil {
+				// 扫描目录暂时不可读(如正在切换分支), 下次再试
+				continue
+			}
+			if !sameSnapshot(last, current) {
+				last = current
+				changedAt = now
+				continue
+			}
+			if !changedAt.IsZero() && now.Sub(changedAt) >= opts.Debounce {
+				changedAt = time.Time{}
+				onGenerate(a.GenDigFile())
+			}
+		}
+	}
+}
+
+// snapshot 所有会被扫描的文件的修改时间和大小, 不包括autodig生成的文件
+func (a *Autodig) snapshot() (map[string]fileStamp, error) {
+	files, testFiles, err := a.getAllFiles(a.scanDirs)
+	if err != nil {
+		return nil, err
+	}
+	files, _ = splitPackageGenFiles(append(files, testFiles...))
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+func sameSnapshot(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, stamp := range a {
+		if other, ok := b[file]; !ok || other != stamp {
+			return false
+		}
+	}
+	return true
+}
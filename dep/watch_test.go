@@ -0,0 +1,71 @@
+package dep
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchDebounce(t *testing.T) {
+	root := newTestModule(t, map[string]string{
+		"app/a/a.go":             "package a\n",
+		"app/entrypoint/main.go": "package entrypoint\n",
+	})
+	outputFile := filepath.Join(root, "app", "entrypoint", "autodig.go")
+	a := NewAutodig([]string{filepath.Join(root, "app")}, outputFile, "")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	generated := make(chan error, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Watch(ctx, WatchOptions{Interval: 10 * time.Millisecond, Debounce: 200 * time.Millisecond}, func(err error) {
+			generated <- err
+		})
+	}()
+	wait := func(what string) {
+		t.Helper()
+		select {
+		case err := <-generated:
+			if err != nil {
+				t.Fatalf("%s generate err: %v", what, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s generate did not happen", what)
+		}
+	}
+	wait("initial")
+
+	// 间隔小于Debounce的多次保存只生成一次, 包含最后一次保存的内容
+	source := "package a\n"
+	for i := 0; i < 5; i++ {
+		source += fmt.Sprintf("\ntype Client%d struct{}\n\n// @autodig\nfunc NewClient%d() *Client%d {\n\treturn &Client%d{}\n}\n", i, i, i, i)
+		if err := ioutil.WriteFile(filepath.Join(root, "app", "a", "a.go"), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+	wait("debounced")
+	select {
+	case err := <-generated:
+		t.Errorf("got another generate (err: %v), want the edits coalesced into one", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+	content, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if !strings.Contains(string(content), fmt.Sprintf("NewClient%d", i)) {
+			t.Errorf("output is missing NewClient%d:\n%s", i, content)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Watch() err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cindyoshinee/autodig/dep"
+)
+
+// configFlags 所有读取源码的命令共用的参数, 显式设置的参数会覆盖配置文件中的值
+type configFlags struct {
+	fs *flag.FlagSet
+	// dir 工作目录, 默认路径和配置文件都基于该目录
+	dir        string
+	configFile string
+	scans      string
+	output     string
+	excludes   string
+	includes   string
+	goos       string
+	goarch     string
+	buildTags  string
+	tag        string
+	maxErrors  int
+	strict     bool
+	mode       string
+	fakes      bool
+	lineDirect bool
+	cacheDir   string
+	noCache    bool
+}
+
+// defaultPaths 默认扫描dir/app, 输出到dir/app/entrypoint/autodig.go.
+// 通过//go:generate autodig调用时, go generate在指令所在的目录执行, 默认扫描并输出到该目录
+func defaultPaths(dir string) (scanDir string, outputFile string) {
+	if dir == "" {
+		return "./app", "./app/entrypoint/autodig.go"
+	}
+	if isGoGenerate() {
+		return dir, filepath.Join(dir, "autodig.go")
+	}
+	return filepath.Join(dir, "app"), filepath.Join(dir, "app", "entrypoint", "autodig.go")
+}
+
+func newConfigFlags(fs *flag.FlagSet) *configFlags {
+	dir, _ := os.Getwd()
+	return newConfigFlagsIn(fs, dir)
+}
+
+// newConfigFlagsIn 以dir为工作目录, dir为空时使用相对路径
+func newConfigFlagsIn(fs *flag.FlagSet, dir string) *configFlags {
+	f := &configFlags{fs: fs, dir: dir}
+	defaultScanDir, defaultOutputFile := defaultPaths(dir)
+	fs.StringVar(&f.configFile, "config", "", "config file path, default find autodig.yaml, autodig.yml or .autodig.json from the working directory upwards, flags set on the command line override it")
+	fs.StringVar(&f.scans, "scans", defaultScanDir, "source code scan dirs, split with ','")
+	fs.StringVar(&f.output, "output", defaultOutputFile, "output file path")
+	fs.StringVar(&f.excludes, "exclude", "", "skip files and dirs matching these globs relative to the scan dir, split with ',', ** matches any dirs, e.g. internal/legacy/**. vendor, testdata, hidden dirs and nested modules are always skipped")
+	fs.StringVar(&f.includes, "include", "", "scan generated files (with a '// Code generated ... DO NOT EDIT.' header) matching these globs, split with ','")
+	fs.StringVar(&f.goos, "goos", "", "only scan files matching build constraints for this GOOS, default $GOOS")
+	fs.StringVar(&f.goarch, "goarch", "", "only scan files matching build constraints for this GOARCH, default $GOARCH")
+	fs.StringVar(&f.buildTags, "tags", "", "build tags used to evaluate //go:build constraints, split with ',', works alongside the autodig -tag")
+	fs.StringVar(&f.tag, "tag", "", "tag, only support one")
+	fs.IntVar(&f.maxErrors, "max-errors", 0, "stop after this many errors, 0 means no limit")
+	fs.BoolVar(&f.strict, "strict", false, "report unknown or malformed annotation keys and unsupported declarations as errors, default true in check mode")
+	fs.StringVar(&f.mode, "mode", dep.OutputModeSingle, "output mode, single: generate everything into the output file, package: generate autodig_gen.go with a Register func in each package and call them from the output file")
+	fs.BoolVar(&f.fakes, "fakes", false, "generate fakes with XxxFunc fields and call recording for DigReturn and injected interfaces into autodig_fake.go, registered instead of the real providers with -tag mock")
+	fs.BoolVar(&f.lineDirect, "line-directives", false, "emit //line directives so stack traces inside generated code point to the annotated source")
+	fs.StringVar(&f.cacheDir, "cache-dir", dep.DefaultCacheDir(), "cache loaded packages, DigReturn checks and the autodig declarations of each file here, keyed by file contents and the Go env, so unchanged files and packages are not parsed, loaded or type checked again")
+	fs.BoolVar(&f.noCache, "no-cache", false, "do not read or write the cache")
+	return f
+}
+
+func (f *configFlags) isSet(name string) bool {
+	set := false
+	f.fs.Visit(func(flag *flag.Flag) {
+		if flag.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// load 读取配置文件, 再用命令行中显式设置的参数覆盖. 没有配置文件时全部使用命令行参数.
+// defaultStrict为配置文件和命令行都没有设置strict时的值
+func (f *configFlags) load(defaultStrict bool) (*dep.Config, error) {
+	config := &dep.Config{}
+	path := f.configFile
+	if path == "" {
+		dir := f.dir
+		if dir == "" {
+			dir = "."
+		}
+		var err error
+		path, err = dep.FindConfig(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if path != "" {
+		var err error
+		config, err = dep.LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 通过go:generate调用时, 指令所在的目录和输出位置优先于配置文件中的scans/output
+	config.GoGenerate = isGoGenerate()
+	if f.isSet("scans") || len(config.Scans) == 0 || config.GoGenerate {
+		config.Scans = strings.Split(f.scans, ",")
+	}
+	if f.output == "-" {
+		// 只输出到stdout, 包名和import路径仍然由配置文件或默认的输出位置决定
+		if config.Output == "" {
+			_, config.Output = defaultPaths(f.dir)
+		}
+	} else if f.isSet("output") || config.Output == "" || config.GoGenerate {
+		config.Output = f.output
+	}
+	if f.isSet("exclude") {
+		config.Excludes = splitList(f.excludes)
+	}
+	if f.isSet("include") {
+		config.Includes = splitList(f.includes)
+	}
+	if f.isSet("goos") {
+		config.GOOS = f.goos
+	}
+	if f.isSet("goarch") {
+		config.GOARCH = f.goarch
+	}
+	if f.isSet("tags") {
+		config.BuildTags = splitList(f.buildTags)
+	}
+	if f.isSet("fakes") {
+		config.Fakes = f.fakes
+	}
+	if f.isSet("line-directives") {
+		config.LineDirectives = f.lineDirect
+	}
+	if f.isSet("cache-dir") || config.CacheDir == "" {
+		config.CacheDir = f.cacheDir
+	}
+	if f.noCache {
+		config.CacheDir = ""
+	}
+	if f.isSet("tag") {
+		config.Tag = f.tag
+	}
+	if f.isSet("max-errors") {
+		config.MaxErrors = f.maxErrors
+	}
+	if f.isSet("mode") || config.Mode == "" {
+		config.Mode = f.mode
+	}
+	if f.isSet("strict") {
+		config.Strict = &f.strict
+	} else if config.Strict == nil {
+		config.Strict = &defaultStrict
+	}
+	return config, config.Validate()
+}
+
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, each := range strings.Split(s, ",") {
+		if each = strings.TrimSpace(each); each != "" {
+			list = append(list, each)
+		}
+	}
+	return list
+}
+
+// isGoGenerate go generate会设置$GOFILE/$GOPACKAGE/$GOLINE
+func isGoGenerate() bool {
+	return os.Getenv("GOFILE") != "" && os.Getenv("GOPACKAGE") != ""
+}
+
+// printErr 通过go:generate调用时在错误前加上指令的位置$GOFILE:$GOLINE, go generate的输出中可以直接定位到指令
+func printErr(err error) {
+	if isGoGenerate() {
+		fmt.Fprintf(os.Stderr, "%s:%s: autodig (package %s): %v\n", os.Getenv("GOFILE"), os.Getenv("GOLINE"), os.Getenv("GOPACKAGE"), err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
+// printConfig 输出本次使用的配置, 便于排查
+func printConfig(config *dep.Config) {
+	if isGoGenerate() {
+		fmt.Fprintf(logOut, "go:generate %s:%s package %s\n", os.Getenv("GOFILE"), os.Getenv("GOLINE"), os.Getenv("GOPACKAGE"))
+	}
+	if config.Path != "" {
+		fmt.Fprintln(logOut, "config", config.Path)
+	}
+	fmt.Fprintln(logOut, "dir", os.Args[0])
+	fmt.Fprintln(logOut, "scanDir", strings.Join(config.Scans, ","))
+	fmt.Fprintln(logOut, "outputFile", config.Output)
+}
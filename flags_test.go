@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// loadedConfig load结果中与优先级有关的字段
+type loadedConfig struct {
+	Scans    []string
+	Output   string
+	Excludes []string
+	Tag      string
+	Mode     string
+	Strict   bool
+	CacheDir string
+}
+
+func TestConfigFlagsLoad(t *testing.T) {
+	const projectConfig = `scans: [./src]
+output: ./out/autodig.go
+excludes: [legacy/**]
+tag: prod
+mode: package
+strict: false
+cache_dir: ./.cache
+`
+	tests := []struct {
+		name string
+		// config 写入工作目录下autodig.yaml的内容, 为空时没有配置文件
+		config string
+		// goGenerate 模拟go generate设置的环境变量
+		goGenerate    bool
+		args          []string
+		defaultStrict bool
+		// want 参数为工作目录
+		want func(dir string) loadedConfig
+	}{
+		{
+			name: "no config uses flag defaults",
+			want: func(dir string) loadedConfig {
+				return loadedConfig{
+					Scans:  []string{filepath.Join(dir, "app")},
+					Output: filepath.Join(dir, "app/entrypoint/autodig.go"),
+					Mode:   "single",
+				}
+			},
+		},
+		{
+			name:          "no config uses the command's default strict",
+			defaultStrict: true,
+			want: func(dir string) loadedConfig {
+				return loadedConfig{
+					Scans:  []string{filepath.Join(dir, "app")},
+					Output: filepath.Join(dir, "app/entrypoint/autodig.go"),
+					Mode:   "single",
+					Strict: true,
+				}
+			},
+		},
+		{
+			name:          "config overrides flag defaults",
+			config:        projectConfig,
+			defaultStrict: true,
+			want: func(dir string) loadedConfig {
+				return loadedConfig{
+					Scans:    []string{filepath.Join(dir, "src")},
+					Output:   filepath.Join(dir, "out/autodig.go"),
+					Excludes: []string{"legacy/**"},
+					Tag:      "prod",
+					Mode:     "package",
+					CacheDir: filepath.Join(dir, ".cache"),
+				}
+			},
+		},
+		{
+			name:   "explicit flags override config",
+			config: projectConfig,
+			args:   []string{"-scans", "./a,./b", "-exclude", "x/**, y", "-tag", "dev", "-mode", "single", "-strict", "-cache-dir", "/tmp/c"},
+			want: func(dir string) loadedConfig {
+				return loadedConfig{
+					Scans:    []string{"./a", "./b"},
+					Output:   filepath.Join(dir, "out/autodig.go"),
+					Excludes: []string{"x/**", "y"},
+					Tag:      "dev",
+					Mode:     "single",
+					Strict:   true,
+					CacheDir: "/tmp/c",
+				}
+			},
+		},
+		{
+			name:   "output - keeps the configured output",
+			config: projectConfig,
+			args:   []string{"-output", "-"},
+			want: func(dir string) loadedConfig {
+				return loadedConfig{
+					Scans:    []string{filepath.Join(dir, "src")},
+					Output:   filepath.Join(dir, "out/autodig.go"),
+					Excludes: []string{"legacy/**"},
+					Tag:      "prod",
+					Mode:     "package",
+					CacheDir: filepath.Join(dir, ".cache"),
+				}
+			},
+		},
+		{
+			name:   "no-cache wins over config cache_dir",
+			config: projectConfig,
+			args:   []string{"-no-cache"},
+			want: func(dir string) loadedConfig {
+				return loadedConfig{
+					Scans:    []string{filepath.Join(dir, "src")},
+					Output:   filepath.Join(dir, "out/autodig.go"),
+					Excludes: []string{"legacy/**"},
+					Tag:      "prod",
+					Mode:     "package",
+				}
+			},
+		},
+		{
+			name:       "go:generate directive dir wins over config scans and output",
+			config:     projectConfig,
+			goGenerate: true,
+			want: func(dir string) loadedConfig {
+				return loadedConfig{
+					Scans:    []string{dir},
+					Output:   filepath.Join(dir, "autodig.go"),
+					Excludes: []string{"legacy/**"},
+					Tag:      "prod",
+					Mode:     "package",
+					CacheDir: filepath.Join(dir, ".cache"),
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 每个用例使用自己的工作目录, 默认路径基于该目录, 也只会找到测试写入的autodig.yaml
+			dir := t.TempDir()
+			if tt.config != "" {
+				if err := ioutil.WriteFile(filepath.Join(dir, "autodig.yaml"), []byte(tt.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.goGenerate {
+				t.Setenv("GOFILE", "gen.go")
+				t.Setenv("GOPACKAGE", "app")
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			cf := newConfigFlagsIn(fs, dir)
+			// 不使用用户的缓存目录作为默认值, 结果与环境无关
+			cf.cacheDir = ""
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			config, err := cf.load(tt.defaultStrict)
+			if err != nil {
+				t.Fatalf("load() err: %v", err)
+			}
+			got := loadedConfig{
+				Scans:    config.Scans,
+				Output:   config.Output,
+				Excludes: config.Excludes,
+				Tag:      config.Tag,
+				Mode:     config.Mode,
+				Strict:   *config.Strict,
+				CacheDir: config.CacheDir,
+			}
+			if want := tt.want(dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("load() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
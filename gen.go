@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cindyoshinee/autodig/dep"
+)
+
+func runGen(args []string) int {
+	fs := newFlagSet("gen")
+	cf := newConfigFlags(fs)
+	fs.Lookup("output").Usage = "output file path, - prints the generated source to stdout like -dry-run"
+	dryRun := fs.Bool("dry-run", false, "print the generated source to stdout instead of writing it")
+	diffMode := fs.Bool("diff", false, "print a unified diff between the existing files and the generated source instead of writing it")
+	report := fs.Bool("report", false, "print unused providers, ingroup without outgroup members and names no provider offers")
+	checkMode := fs.Bool("check", false, "check the output file is up to date without writing it, same as 'autodig check'")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *checkMode {
+		return check(cf, *report)
+	}
+	if cf.output == "-" {
+		*dryRun = true
+	}
+	fmt.Fprintln(logOut, "=========autodig start==========")
+	config, err := cf.load(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	printConfig(config)
+	autodig := config.NewAutodig()
+	if *dryRun || *diffMode {
+		return preview(autodig, *diffMode, *report)
+	}
+	err = autodig.GenDigFile()
+	autodig.Diagnostics().Print(os.Stderr)
+	if *report {
+		autodig.Report().Print(os.Stdout)
+	}
+	if err != nil {
+		printErr(err)
+		return exitFailed
+	}
+	fmt.Fprintln(logOut, "=========autodig success!!==========")
+	return exitOK
+}
+
+func runCheck(args []string) int {
+	fs := newFlagSet("check")
+	cf := newConfigFlags(fs)
+	report := fs.Bool("report", false, "print unused providers, ingroup without outgroup members and names no provider offers")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	return check(cf, *report)
+}
+
+// check 默认strict, 文件过期时以exitStale退出
+func check(cf *configFlags, report bool) int {
+	fmt.Fprintln(logOut, "=========autodig start==========")
+	config, err := cf.load(true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	printConfig(config)
+	autodig := config.NewAutodig()
+	result, err := autodig.Check()
+	autodig.Diagnostics().Print(os.Stderr)
+	if report {
+		autodig.Report().Print(os.Stdout)
+	}
+	if err != nil {
+		printErr(err)
+		return exitFailed
+	}
+	if !result.Stale {
+		fmt.Fprintln(logOut, "=========autodig check: up to date==========")
+		return exitOK
+	}
+	fmt.Printf("%s is stale:\n", result.OutputFile)
+	for _, reason := range result.Reasons {
+		fmt.Printf("  - %s\n", reason)
+	}
+	fmt.Print(result.Diff)
+	return exitStale
+}
+
+// preview diffMode时输出与磁盘上文件的unified diff, 否则输出生成的代码, 都不会写入文件
+func preview(autodig *dep.Autodig, diffMode bool, report bool) int {
+	files, staleFiles, err := autodig.Generate(context.Background())
+	autodig.Diagnostics().Print(os.Stderr)
+	if report {
+		autodig.Report().Print(os.Stderr)
+	}
+	if err != nil {
+		printErr(err)
+		return exitFailed
+	}
+	if diffMode {
+		for _, file := range files {
+			old, err := ioutil.ReadFile(file.Path)
+			if err != nil && !os.IsNotExist(err) {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailed
+			}
+			fmt.Print(dep.UnifiedDiff(file.Path, file.Path+" (regenerated)", old, file.Content))
+		}
+		for _, file := range staleFiles {
+			old, err := ioutil.ReadFile(file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return exitFailed
+			}
+			fmt.Print(dep.UnifiedDiff(file, file+" (deleted)", old, nil))
+		}
+		return exitOK
+	}
+	// 只有一个文件时直接输出内容, 可以重定向到文件
+	if len(files) == 1 && len(staleFiles) == 0 {
+		os.Stdout.Write(files[0].Content)
+		return exitOK
+	}
+	for i, file := range files {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("// file: %s\n", file.Path)
+		os.Stdout.Write(file.Content)
+	}
+	for _, file := range staleFiles {
+		fmt.Printf("// delete: %s\n", file)
+	}
+	return exitOK
+}
+
+// runWatch 文件变化后重新生成, 出错时只输出错误, 直到Ctrl+C
+func runWatch(args []string) int {
+	fs := newFlagSet("watch")
+	cf := newConfigFlags(fs)
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often the scan dirs are polled for changes")
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "how long to wait after the last change before regenerating")
+	report := fs.Bool("report", false, "print unused providers, ingroup without outgroup members and names no provider offers")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	fmt.Fprintln(logOut, "=========autodig start==========")
+	config, err := cf.load(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	printConfig(config)
+	autodig := config.NewAutodig()
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+	fmt.Fprintln(logOut, "=========autodig watching, press Ctrl+C to stop==========")
+	err = autodig.Watch(ctx, dep.WatchOptions{Interval: *interval, Debounce: *debounce}, func(err error) {
+		autodig.Diagnostics().Print(os.Stderr)
+		if *report {
+			autodig.Report().Print(os.Stdout)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s autodig failed: %v\n", time.Now().Format("15:04:05"), err)
+			return
+		}
+		fmt.Fprintf(logOut, "%s autodig regenerated\n", time.Now().Format("15:04:05"))
+	})
+	if err != nil && err != context.Canceled {
+		printErr(err)
+		return exitFailed
+	}
+	return exitOK
+}
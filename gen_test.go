@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenPreview(t *testing.T) {
+	root := newTestModule(t, map[string]string{
+		"app/a/a.go":             serviceSource,
+		"app/entrypoint/main.go": "package entrypoint\n",
+	})
+	outputFile := filepath.Join(root, "app", "entrypoint", "autodig.go")
+	if _, stderr, code := runAutodig(t, root, "gen"); code != exitOK {
+		t.Fatalf("gen exit code %d:\n%s", code, stderr)
+	}
+	generated, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 输出与写入的文件相同, 可以直接重定向
+	for _, args := range [][]string{{"gen", "-dry-run"}, {"gen", "-output", "-"}} {
+		stdout, stderr, code := runAutodig(t, root, args...)
+		if code != exitOK || stdout != string(generated) {
+			t.Errorf("autodig %v exit code %d, stdout =\n%s\nwant the generated file:\n%s\nstderr:\n%s", args, code, stdout, generated, stderr)
+		}
+	}
+
+	stdout, _, code := runAutodig(t, root, "gen", "-diff")
+	if code != exitOK || stdout != "" {
+		t.Errorf("-diff of an up to date file exit code %d, stdout =\n%s\nwant empty", code, stdout)
+	}
+
+	edited := serviceSource + "\n// @autodig\ntype Other struct{}\n"
+	if err := ioutil.WriteFile(filepath.Join(root, "app", "a", "a.go"), []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr, code := runAutodig(t, root, "gen", "-diff")
+	if code != exitOK {
+		t.Fatalf("-diff exit code %d:\n%s", code, stderr)
+	}
+	wantPrefix := "--- " + outputFile + "\n+++ " + outputFile + " (regenerated)\n@@ "
+	if !strings.HasPrefix(stdout, wantPrefix) || !strings.Contains(stdout, "\n+func NewaOther() (*a.Other, error) {\n") {
+		t.Errorf("-diff stdout =\n%s\nwant a diff of %s adding Other", stdout, outputFile)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		if line == "" || !strings.ContainsAny(line[:1], " +-@") {
+			t.Errorf("-diff stdout has a line that is not part of a unified diff: %q", line)
+		}
+	}
+
+	// 预览都不会修改文件
+	if content, err := ioutil.ReadFile(outputFile); err != nil || string(content) != string(generated) {
+		t.Errorf("%s was modified by a preview, err: %v", outputFile, err)
+	}
+	entries, err := ioutil.ReadDir(filepath.Dir(outputFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		names := make([]string, 0)
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("files in %s = %v, want main.go and autodig.go", filepath.Dir(outputFile), names)
+	}
+}
@@ -5,4 +5,5 @@ go 1.13
 require (
 	go.uber.org/dig v1.13.0
 	golang.org/x/tools v0.1.5
+	gopkg.in/yaml.v2 v2.4.0
 )
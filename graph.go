@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cindyoshinee/autodig/autodig"
+	"github.com/cindyoshinee/autodig/dep"
+)
+
+// analyze 在内存中生成, 不写入文件. stdout只输出结果, 错误和警告输出到stderr.
+// 返回值小于0表示继续执行, 否则为退出码
+func analyze(cf *configFlags) (*autodig.Result, int) {
+	config, err := cf.load(false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, exitUsage
+	}
+	result, err := autodig.New(autodig.WithConfig(config)).Generate(context.Background())
+	if result != nil {
+		for _, diag := range result.Diagnostics {
+			fmt.Fprintln(os.Stderr, diag)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, exitFailed
+	}
+	return result, -1
+}
+
+func runGraph(args []string) int {
+	fs := newFlagSet("graph")
+	cf := newConfigFlags(fs)
+	format := fs.String("format", "text", "output format, text or dot (graphviz)")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *format != "text" && *format != "dot" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, should be text or dot\n", *format)
+		return exitUsage
+	}
+	result, code := analyze(cf)
+	if code >= 0 {
+		return code
+	}
+	if *format == "dot" {
+		printDot(result.Providers)
+		return exitOK
+	}
+	for _, provider := range result.Providers {
+		fmt.Printf("%s provides %s\n", provider, describeProvides(provider))
+		for _, d := range provider.Deps {
+			fmt.Printf("  <- %s: %s\n", describeDep(d), describeSatisfiers(result.Providers, d))
+		}
+	}
+	if !result.Graph.Empty() {
+		fmt.Println()
+		result.Graph.Print(os.Stdout)
+	}
+	return exitOK
+}
+
+// printDot 边从被依赖的provider指向依赖它的provider, 没有provider满足的依赖用虚线节点表示
+func printDot(providers []*dep.Provider) {
+	fmt.Println("digraph autodig {")
+	fmt.Println("\trankdir=LR;")
+	fmt.Println("\tnode [shape=box];")
+	for _, provider := range providers {
+		fmt.Printf("\t%q [label=%q];\n", provider.Func, provider.Symbol)
+	}
+	for _, provider := range providers {
+		for _, d := range provider.Deps {
+			satisfiers := dep.ProvidersOf(providers, d)
+			if len(satisfiers) == 0 {
+				missing := "missing:" + describeDep(d)
+				fmt.Printf("\t%q [label=%q, style=dashed];\n", missing, describeDep(d))
+				fmt.Printf("\t%q -> %q [style=dashed];\n", missing, provider.Func)
+				continue
+			}
+			for _, from := range satisfiers {
+				fmt.Printf("\t%q -> %q [label=%q];\n", from.Func, provider.Func, describeDep(d))
+			}
+		}
+	}
+	fmt.Println("}")
+}
+
+func runExplain(args []string) int {
+	fs := newFlagSet("explain")
+	cf := newConfigFlags(fs)
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	query := fs.Arg(0)
+	result, code := analyze(cf)
+	if code >= 0 {
+		return code
+	}
+	matched := make([]*dep.Provider, 0)
+	for _, provider := range result.Providers {
+		if matchProvider(provider, query) {
+			matched = append(matched, provider)
+		}
+	}
+	if len(matched) == 0 {
+		fmt.Fprintf(os.Stderr, "no provider matches %q\n", query)
+		return exitFailed
+	}
+	for i, provider := range matched {
+		if i > 0 {
+			fmt.Println()
+		}
+		explain(result.Providers, provider)
+	}
+	return exitOK
+}
+
+// matchProvider query可以是源码中的symbol(demo.Service或Service)、生成的函数名或提供的类型(*demo.Service或demo.Service)
+func matchProvider(provider *dep.Provider, query string) bool {
+	if provider.Symbol == query || provider.Func == query {
+		return true
+	}
+	if i := strings.LastIndex(provider.Symbol, "."); i >= 0 && provider.Symbol[i+1:] == query {
+		return true
+	}
+	for _, typ := range provider.Provides {
+		if typ == query || strings.TrimPrefix(typ, "*") == query {
+			return true
+		}
+	}
+	return false
+}
+
+func explain(providers []*dep.Provider, provider *dep.Provider) {
+	fmt.Printf("%s (%s)\n", provider.Symbol, provider.Pos)
+	fmt.Printf("  annotation: %s\n", provider.Annotation)
+	fmt.Printf("  generated func: %s\n", provider.Func)
+	fmt.Printf("  provides: %s\n", describeProvides(provider))
+	if provider.Tag != "" {
+		fmt.Printf("  tag: %s\n", provider.Tag)
+	}
+	if len(provider.Deps) == 0 {
+		fmt.Println("  depends on: nothing")
+	} else {
+		fmt.Println("  depends on:")
+		for _, d := range provider.Deps {
+			fmt.Printf("    %s (%s)\n", describeDep(d), d.Pos)
+			satisfiers := dep.ProvidersOf(providers, d)
+			if len(satisfiers) == 0 {
+				fmt.Println("      <- no annotated provider, must be provided elsewhere")
+			}
+			for _, from := range satisfiers {
+				fmt.Printf("      <- %s\n", from)
+			}
+		}
+	}
+	consumers := make([]string, 0)
+	for _, other := range providers {
+		for _, d := range other.Deps {
+			if provider.Satisfies(d) {
+				consumers = append(consumers, fmt.Sprintf("%s via %s", other, describeDep(d)))
+			}
+		}
+	}
+	if len(consumers) == 0 {
+		fmt.Println("  consumed by: no annotated provider")
+		return
+	}
+	fmt.Println("  consumed by:")
+	for _, consumer := range consumers {
+		fmt.Printf("    %s\n", consumer)
+	}
+}
+
+func describeProvides(provider *dep.Provider) string {
+	ret := strings.Join(provider.Provides, ", ")
+	if provider.Group != "" {
+		ret += " outgroup:" + provider.Group
+	}
+	if provider.Name != "" {
+		ret += " name:" + provider.Name
+	}
+	return ret
+}
+
+func describeDep(d *dep.Dependency) string {
+	switch {
+	case d.Group != "":
+		return d.Type + " ingroup:" + d.Group
+	case d.Name != "":
+		return d.Type + " name:" + d.Name
+	default:
+		return d.Type
+	}
+}
+
+func describeSatisfiers(providers []*dep.Provider, d *dep.Dependency) string {
+	satisfiers := dep.ProvidersOf(providers, d)
+	if len(satisfiers) == 0 {
+		return "(no annotated provider)"
+	}
+	names := make([]string, 0, len(satisfiers))
+	for _, provider := range satisfiers {
+		names = append(names, provider.Symbol)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/cindyoshinee/autodig/dep"
+)
+
+var initConfigTemplate = template.Must(template.New("autodig.yaml").Parse(`# autodig配置, 命令行参数会覆盖其中的值, 相对路径基于本文件所在目录
+scans:
+{{- range .Scans}}
+  - {{.}}
+{{- end}}
+output: {{.Output}}
+# 跳过的文件和目录, ** 匹配任意层目录
+excludes: []
+# 只生成没有tag或tag相同的声明
+tag: ""
+# single: 全部生成到output, package: 每个包生成autodig_gen.go
+mode: {{.Mode}}
+# check默认strict, 这里设置后gen也会检查未知的注解
+# strict: true
+`))
+
+// runInit 在当前目录写入autodig.yaml, 已经存在配置文件时不覆盖
+func runInit(args []string) int {
+	fs := newFlagSet("init")
+	scans := fs.String("scans", "./app", "source code scan dirs written to the config, split with ','")
+	output := fs.String("output", "./app/entrypoint/autodig.go", "output file path written to the config")
+	mode := fs.String("mode", dep.OutputModeSingle, "output mode written to the config, single or package")
+	force := fs.Bool("force", false, "overwrite an existing config file in the working directory")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if err := (&dep.Config{Mode: *mode}).Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	if !*force {
+		for _, name := range dep.ConfigFileNames {
+			if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+				fmt.Fprintf(os.Stderr, "%s already exists, use -force to overwrite\n", name)
+				return exitFailed
+			}
+		}
+	}
+	buffer := &strings.Builder{}
+	err = initConfigTemplate.Execute(buffer, map[string]interface{}{
+		"Scans":  splitList(*scans),
+		"Output": *output,
+		"Mode":   *mode,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	path := filepath.Join(dir, dep.ConfigFileNames[0])
+	if err := ioutil.WriteFile(path, []byte(buffer.String()), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	fmt.Println("wrote", path)
+	return exitOK
+}
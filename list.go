@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cindyoshinee/autodig/dep"
+)
+
+// listEntry list -format json输出的一个provider, 字段名是脚本依赖的接口, 只增不改
+type listEntry struct {
+	Func     string   `json:"func"`
+	Symbol   string   `json:"symbol"`
+	Provides []string `json:"provides"`
+	Name     string   `json:"name,omitempty"`
+	Group    string   `json:"group,omitempty"`
+	// Tag 为空表示任何-tag都会生成
+	Tag      string `json:"tag,omitempty"`
+	Init     bool   `json:"init"`
+	Position string `json:"position"`
+}
+
+func newListEntry(provider *dep.Provider) *listEntry {
+	return &listEntry{
+		Func:     provider.Func,
+		Symbol:   provider.Symbol,
+		Provides: provider.Provides,
+		Name:     provider.Name,
+		Group:    provider.Group,
+		Tag:      provider.Tag,
+		Init:     provider.Init,
+		Position: provider.RelPos,
+	}
+}
+
+// runList 输出本次配置(-tag/-tags/-goos等)下会注册的所有provider, 顺序与生成代码一致
+func runList(args []string) int {
+	fs := newFlagSet("list")
+	cf := newConfigFlags(fs)
+	format := fs.String("format", "table", "output format, table or json")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, should be table or json\n", *format)
+		return exitUsage
+	}
+	result, code := analyze(cf)
+	if code >= 0 {
+		return code
+	}
+	entries := make([]*listEntry, 0, len(result.Providers))
+	for _, provider := range result.Providers {
+		entries = append(entries, newListEntry(provider))
+	}
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailed
+		}
+		return exitOK
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FUNC\tSYMBOL\tPROVIDES\tNAME\tGROUP\tTAG\tINIT\tPOSITION")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Func, entry.Symbol, strings.Join(entry.Provides, ","),
+			orDash(entry.Name), orDash(entry.Group), orDash(entry.Tag), yesNo(entry.Init), entry.Position)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// orDash 表格中的空值输出为-, 保持列对齐, 方便awk等按列处理
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
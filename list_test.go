@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestListJSON(t *testing.T) {
+	root := newTestModule(t, map[string]string{
+		"app/a/a.go": `package a
+
+type Logger interface{}
+
+type Client struct{}
+
+// @autodig name:primary tag:prod
+func NewClient() *Client {
+	return &Client{}
+}
+
+// @autodig outgroup:loggers
+func NewLogger() Logger {
+	return nil
+}
+
+// @autodig
+type Service struct {
+	Client  *Client  ` + "`autodig:\"name:primary\"`" + `
+	Loggers []Logger ` + "`autodig:\"ingroup:loggers\"`" + `
+}
+
+func (s *Service) Init() error {
+	return nil
+}
+
+// @autodig tag:dev
+func NewDevClient() *Client {
+	return &Client{}
+}
+`,
+		"app/entrypoint/main.go": "package entrypoint\n",
+	})
+	stdout, stderr, code := runAutodig(t, root, "list", "-format", "json", "-tag", "prod")
+	if code != exitOK {
+		t.Fatalf("list exit code %d:\n%s", code, stderr)
+	}
+	// 字段名是脚本依赖的接口, 空的name/group/tag不输出
+	var got []map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("list output is not a JSON array: %v\n%s", err, stdout)
+	}
+	want := []map[string]interface{}{
+		{
+			"func":     "a_NewClient",
+			"symbol":   "a.NewClient",
+			"provides": []interface{}{"*a.Client"},
+			"name":     "primary",
+			"tag":      "prod",
+			"init":     false,
+			"position": "app/a/a.go:8",
+		},
+		{
+			"func":     "a_NewLogger",
+			"symbol":   "a.NewLogger",
+			"provides": []interface{}{"a.Logger"},
+			"group":    "loggers",
+			"init":     false,
+			"position": "app/a/a.go:13",
+		},
+		{
+			"func":     "NewaService",
+			"symbol":   "a.Service",
+			"provides": []interface{}{"*a.Service"},
+			"init":     true,
+			"position": "app/a/a.go:18",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.MarshalIndent(got, "", "  ")
+		wantJSON, _ := json.MarshalIndent(want, "", "  ")
+		t.Errorf("list -format json =\n%s\nwant\n%s", gotJSON, wantJSON)
+	}
+}
@@ -3,51 +3,150 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/cindyoshinee/autodig/dep"
 )
 
-var (
-	scanDir    string
-	outputFile string
-	tag        string
+// 退出码, 脚本可以依赖这些值
+const (
+	exitOK = 0
+	// exitFailed 生成失败、源码有错误或者explain没有找到匹配的provider
+	exitFailed = 1
+	// exitUsage 参数错误、未知命令或配置文件错误
+	exitUsage = 2
+	// exitStale check发现生成文件过期
+	exitStale = 3
 )
 
+// logOut 进度信息的输出, stdout只用来输出结果(生成的代码、diff、check的过期原因、list/graph等)
+var logOut io.Writer = os.Stderr
+
+type command struct {
+	name string
+	// args 命令的参数说明, 显示在usage中
+	args  string
+	short string
+	run   func(args []string) int
+}
+
+var commands []*command
+
 func init() {
-	dir, err := os.Getwd()
-	if err != nil {
-		fmt.Println(err)
-		return
+	commands = []*command{
+		{name: "gen", args: "[flags]", short: "generate the dig providers (default command)", run: runGen},
+		{name: "check", args: "[flags]", short: "check the generated files are up to date without writing them", run: runCheck},
+		{name: "watch", args: "[flags]", short: "regenerate when .go files in the scan dirs change", run: runWatch},
+		{name: "graph", args: "[flags]", short: "print the dependency graph between providers", run: runGraph},
+		{name: "list", args: "[flags]", short: "list every provider autodig would register", run: runList},
+		{name: "explain", args: "[flags] <symbol|func|type>", short: "show where a provider comes from, what it needs and who consumes it", run: runExplain},
+		{name: "init", args: "[flags]", short: "write a starter autodig.yaml to the working directory", run: runInit},
+		{name: "version", args: "", short: "print the autodig version", run: runVersion},
+		{name: "help", args: "[command]", short: "show help for a command", run: runHelp},
 	}
-	flag.StringVar(&scanDir, "scans", fmt.Sprintf("%s/app", dir), "source code scan dirs, split with ','")
-	flag.StringVar(&outputFile, "output", fmt.Sprintf("%s/app/entrypoint/autodig.go", dir), "output file path")
-	flag.StringVar(&tag, "tag", "", "tag, only support one")
 }
 
 func main() {
-	fmt.Println("=========autodig start==========")
-	flag.Parse()
-	scanDirFlag := flag.Lookup("scan")
-	outputFileFlag := flag.Lookup("output")
-	tagFlag := flag.Lookup("tag")
-	if scanDirFlag != nil {
-		scanDir = scanDirFlag.Value.String()
-	}
-	if outputFileFlag != nil {
-		outputFile = outputFileFlag.Value.String()
-	}
-	if tagFlag != nil {
-		tag = tagFlag.Value.String()
-	}
-	fmt.Println("dir", os.Args[0])
-	fmt.Println("scanDir", scanDir)
-	fmt.Println("outputFile", outputFile)
-	err := dep.NewAutodig(strings.Split(scanDir, ","), outputFile, tag).GenDigFile()
+	os.Exit(run(os.Args[1:]))
+}
+
+// run 没有子命令或第一个参数是flag时执行gen, 兼容之前的`autodig -scans ...`
+func run(args []string) int {
+	if len(args) == 0 {
+		return runGen(args)
+	}
+	switch args[0] {
+	case "-h", "-help", "--help":
+		usage(os.Stdout)
+		return exitOK
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return runGen(args)
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage(os.Stderr)
+		return exitUsage
+	}
+	return cmd.run(args[1:])
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "autodig generates uber dig providers from //@autodig annotations.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "usage: autodig <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "exit codes: 0 ok, 1 failed, 2 usage or config error, 3 check found stale files")
+	fmt.Fprintln(w, "run `autodig help <command>` or `autodig <command> -h` for the flags of a command.")
+}
+
+// newFlagSet 每个命令单独的FlagSet, -h输出命令的说明和参数
+func newFlagSet(name string) *flag.FlagSet {
+	cmd := findCommand(name)
+	fs := flag.NewFlagSet("autodig "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: autodig %s %s\n\n%s\n", cmd.name, cmd.args, cmd.short)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) {
+			hasFlags = true
+		})
+		if hasFlags {
+			fmt.Fprintln(fs.Output(), "\nflags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseFlags 返回值小于0表示继续执行, 否则为退出码. -h时退出码为0
+func parseFlags(fs *flag.FlagSet, args []string) int {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK
+	}
 	if err != nil {
-		fmt.Println(err)
-		panic(err)
+		return exitUsage
+	}
+	return -1
+}
+
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		usage(os.Stdout)
+		return exitOK
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+		usage(os.Stderr)
+		return exitUsage
+	}
+	return cmd.run([]string{"-h"})
+}
+
+func runVersion(args []string) int {
+	fs := newFlagSet("version")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
 	}
-	fmt.Println("=========autodig success!!==========")
+	fmt.Println("autodig", dep.Version)
+	return exitOK
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// runMainEnv 设置时测试二进制作为autodig命令执行, 用于测试输出和退出码
+const runMainEnv = "AUTODIG_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		os.Exit(run(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// runAutodig 在dir中执行autodig args, 返回stdout、stderr和退出码
+func runAutodig(t *testing.T, dir string, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("run autodig %v err: %v", args, err)
+	}
+	return stdout.String(), stderr.String(), 0
+}
+
+// newTestModule 在临时目录中创建module example.com/x并写入files, 通过replace使用当前的autodig, 返回module根目录
+func newTestModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile(filepath.Join(repo, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["go.mod"] = fmt.Sprintf("module example.com/x\n\ngo 1.13\n\nrequire github.com/cindyoshinee/autodig v0.0.0\n\nreplace github.com/cindyoshinee/autodig => %s\n", repo)
+	files["go.sum"] = string(sum)
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 缺少的require从autodig的go.mod补全, 不访问网络
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	// 不读写用户的autodig缓存目录, go的build缓存仍然使用原来的位置
+	if os.Getenv("GOCACHE") == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			t.Setenv("GOCACHE", filepath.Join(dir, "go-build"))
+		}
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	return root
+}
+
+const serviceSource = `package a
+
+type Client struct{}
+
+// @autodig
+func NewClient() *Client {
+	return &Client{}
+}
+
+// @autodig name:primary
+type Service struct {
+	Client *Client
+}
+`
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		// source app/a/a.go的内容
+		source string
+		// generated 先执行一次gen
+		generated bool
+		// edit gen之后app/a/a.go的内容
+		edit string
+		args []string
+		want int
+	}{
+		{name: "gen", source: serviceSource, args: nil, want: exitOK},
+		{name: "gen subcommand", source: serviceSource, args: []string{"gen"}, want: exitOK},
+		{name: "help", source: serviceSource, args: []string{"help", "list"}, want: exitOK},
+		{name: "command -h", source: serviceSource, args: []string{"check", "-h"}, want: exitOK},
+		{name: "source error", source: "package a\n\n// @autodig\nfunc New() int {\n", args: []string{"gen"}, want: exitFailed},
+		{name: "strict error", source: "package a\n\n// @autodig outgrop:x\nfunc New() int {\n\treturn 0\n}\n", args: []string{"gen", "-strict"}, want: exitFailed},
+		{name: "unknown command", source: serviceSource, args: []string{"generate"}, want: exitUsage},
+		{name: "unknown flag", source: serviceSource, args: []string{"gen", "-nope"}, want: exitUsage},
+		{name: "unknown list format", source: serviceSource, args: []string{"list", "-format", "xml"}, want: exitUsage},
+		{name: "bad config", source: serviceSource, args: []string{"gen", "-config", "missing.yaml"}, want: exitUsage},
+		{name: "check up to date", source: serviceSource, generated: true, args: []string{"check"}, want: exitOK},
+		{name: "check missing output", source: serviceSource, args: []string{"check"}, want: exitStale},
+		{name: "check stale", source: serviceSource, generated: true, edit: serviceSource + "\n// @autodig\ntype Other struct{}\n", args: []string{"check"}, want: exitStale},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTestModule(t, map[string]string{
+				"app/a/a.go":             tt.source,
+				"app/entrypoint/main.go": "package entrypoint\n",
+			})
+			if tt.generated {
+				if _, stderr, code := runAutodig(t, root, "gen"); code != exitOK {
+					t.Fatalf("gen exit code %d:\n%s", code, stderr)
+				}
+			}
+			if tt.edit != "" {
+				if err := ioutil.WriteFile(filepath.Join(root, "app", "a", "a.go"), []byte(tt.edit), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, stderr, code := runAutodig(t, root, tt.args...); code != tt.want {
+				t.Errorf("autodig %v exit code %d, want %d:\n%s", tt.args, code, tt.want, stderr)
+			}
+		})
+	}
+}